@@ -22,20 +22,30 @@ func main() {
 
 	urlStorage, err := repository.NewRepository(context.Background(), *cfg)
 	if err != nil {
-		log.Error().
+		log.Fatal().
 			Err(err).
 			Msg("Failed to create repository")
 	}
 
-	idGenerator := shortener.NewRandomStringURLIDGenerator(cfg.ShortURLIdentifierLength)
+	idGenerator, err := shortener.NewURLIDGenerator(*cfg, urlStorage)
+	if err != nil {
+		log.Fatal().
+			Err(err).
+			Msg("Failed to create url id generator")
+	}
 
-	app.StartURLShortenerServer(*cfg, urlStorage, idGenerator)
+	if err = app.StartURLShortenerServer(*cfg, urlStorage, idGenerator); err != nil {
+		log.Fatal().
+			Err(err).
+			Msg("Server failed")
+	}
 }
 
-func configureLogger(_ config.Config) {
+func configureLogger(cfg config.Config) {
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
+	app.SetLogLevel(cfg.LogLevel)
 
-	// в дальнейшем можно добавить в конфиг требуемый уровень логирования, аутпут (файл или еще чего) и т.д.
+	// в дальнейшем можно добавить в конфиг аутпут (файл или еще чего) и т.д.
 	// пока пишем в консоль красивенько
 	log.Logger = log.With().Caller().Logger().Output(zerolog.ConsoleWriter{Out: os.Stderr})
 }
@@ -4,16 +4,75 @@ import (
 	"flag"
 	"fmt"
 	"github.com/caarlos0/env/v6"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"time"
 )
 
 type Config struct {
-	ServerAddress            string `env:"SERVER_ADDRESS" envDefault:":8080"`
-	BaseURL                  string `env:"BASE_URL" envDefault:"http://localhost:8080"`
-	StorageFilePath          string `env:"FILE_STORAGE_PATH"`
-	AuthSecretKey            string `env:"AUTH_SECRET_KEY" envDefault:"very very secret key"`
-	DatabaseDSN              string `env:"DATABASE_DSN"`
-	ShortenBatchSize         int    `env:"SHORTEN_BATCH_SIZE" envDefault:"100"`
-	ShortURLIdentifierLength int    `env:"URL_ID_LENGTH" envDefault:"10"`
+	// ConfigFile файл конфигурации в формате JSON или YAML. Приоритет значений: умолчания < файл < переменные окружения < флаги
+	ConfigFile               string `env:"CONFIG" yaml:"-"`
+	ServerAddress            string `env:"SERVER_ADDRESS" yaml:"server_address" envDefault:":8080"`
+	BaseURL                  string `env:"BASE_URL" yaml:"base_url" envDefault:"http://localhost:8080"`
+	StorageFilePath          string `env:"FILE_STORAGE_PATH" yaml:"file_storage_path"`
+	AuthSecretKey            string `env:"AUTH_SECRET_KEY" yaml:"auth_secret_key" envDefault:"very very secret key"`
+	DatabaseDSN              string `env:"DATABASE_DSN" yaml:"database_dsn"`
+	ShortenBatchSize         int    `env:"SHORTEN_BATCH_SIZE" yaml:"shorten_batch_size" envDefault:"100"`
+	ShortURLIdentifierLength int    `env:"URL_ID_LENGTH" yaml:"url_id_length" envDefault:"10"`
+	// EnableHTTPS сервер принимает только HTTPS-соединения. BaseURL, если не задан явно, по умолчанию тоже https
+	EnableHTTPS bool `env:"ENABLE_HTTPS" yaml:"enable_https"`
+	// TLSCertFile, TLSKeyFile сертификат и ключ сервера в формате PEM. Если обоих файлов нет - при запуске генерируется самоподписанный сертификат и сохраняется в них
+	TLSCertFile string `env:"TLS_CERT_FILE" yaml:"tls_cert_file" envDefault:"cert.pem"`
+	TLSKeyFile  string `env:"TLS_KEY_FILE" yaml:"tls_key_file" envDefault:"key.pem"`
+	// URLIDGenerator тип генератора идентификаторов ссылок: random (math/rand), secure (crypto/rand), sequential (счетчик в хранилище) или hash (хеш ссылки, только с URLUniquenessScope global)
+	URLIDGenerator string `env:"URL_ID_GENERATOR" yaml:"url_id_generator" envDefault:"secure"`
+	// URLIDAlphabet символы, из которых генерируются идентификаторы ссылок генератором secure. Пустое значение - латинские буквы и цифры
+	URLIDAlphabet string `env:"URL_ID_ALPHABET" yaml:"url_id_alphabet"`
+	// URLIDObfuscationKey ключ перестановки значений счетчика генератором sequential. Пустое значение - идентификаторы не перемешиваются
+	URLIDObfuscationKey string `env:"URL_ID_OBFUSCATION_KEY" yaml:"url_id_obfuscation_key"`
+	// URLIDHashKey ключ хеширования ссылок генератором hash. Пустое значение - ключ выводится из AuthSecretKey
+	URLIDHashKey string `env:"URL_ID_HASH_KEY" yaml:"url_id_hash_key"`
+	// URLUniquenessScope область уникальности оригинальных ссылок: global (на весь сервис), user (на пользователя) или none
+	URLUniquenessScope string `env:"URL_UNIQUENESS_SCOPE" yaml:"url_uniqueness_scope" envDefault:"global"`
+	// MigrateURLUniquenessScope разрешает изменить область уникальности, записанную в БД, на URLUniquenessScope. Без него при расхождении сервис не запускается
+	MigrateURLUniquenessScope bool `env:"MIGRATE_URL_UNIQUENESS_SCOPE" yaml:"migrate_url_uniqueness_scope"`
+	// ShortenMaxAttempts сколько раз пытаемся сохранить ссылку со сгенерированным идентификатором, если он оказывается занят
+	ShortenMaxAttempts int `env:"SHORTEN_MAX_ATTEMPTS" yaml:"shorten_max_attempts" envDefault:"5"`
+	// LogLevel уровень логирования: trace, debug, info, warn, error, fatal, panic или disabled
+	LogLevel string `env:"LOG_LEVEL" yaml:"log_level" envDefault:"info"`
+	// ShutdownTimeout сколько времени при остановке сервиса ждем завершения начатых запросов и фоновых задач
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" yaml:"shutdown_timeout" envDefault:"30s"`
+	// ExpiredURLsPurgeInterval периодичность запуска очистки хранилища от просроченных ссылок. 0 - очистка не запускается
+	ExpiredURLsPurgeInterval time.Duration `env:"EXPIRED_URLS_PURGE_INTERVAL" yaml:"expired_urls_purge_interval" envDefault:"1h"`
+	// ExpiredURLsRetention сколько времени просроченная ссылка хранится (и отдает 410) до окончательного удаления
+	ExpiredURLsRetention time.Duration `env:"EXPIRED_URLS_RETENTION" yaml:"expired_urls_retention" envDefault:"168h"`
+	// DeletedURLsPurgeInterval периодичность запуска очистки хранилища от удаленных ссылок. 0 - очистка не запускается
+	DeletedURLsPurgeInterval time.Duration `env:"DELETED_URLS_PURGE_INTERVAL" yaml:"deleted_urls_purge_interval" envDefault:"1h"`
+	// DeletedURLsRetention сколько времени удаленная ссылка хранится (и может быть восстановлена) до окончательного удаления
+	DeletedURLsRetention time.Duration `env:"DELETED_URLS_RETENTION" yaml:"deleted_urls_retention" envDefault:"720h"`
+	// DeleteBatchSize сколько ссылок пользователя накапливается из запросов на удаление, прежде чем они удаляются одним запросом к хранилищу
+	DeleteBatchSize int `env:"DELETE_BATCH_SIZE" yaml:"delete_batch_size" envDefault:"100"`
+	// DeleteFlushInterval как долго запросы на удаление накапливаются, если DeleteBatchSize не набран
+	DeleteFlushInterval time.Duration `env:"DELETE_FLUSH_INTERVAL" yaml:"delete_flush_interval" envDefault:"200ms"`
+	// DeleteWorkers сколько запросов на удаление к хранилищу выполняется одновременно
+	DeleteWorkers int `env:"DELETE_WORKERS" yaml:"delete_workers" envDefault:"5"`
+	// DeleteMaxAttempts сколько раз пытаемся удалить ссылки при ошибках хранилища
+	DeleteMaxAttempts int `env:"DELETE_MAX_ATTEMPTS" yaml:"delete_max_attempts" envDefault:"3"`
+	// DeletionTasksRetention сколько времени хранится статус завершенной задачи удаления ссылок. 0 - до перезапуска сервиса
+	DeletionTasksRetention time.Duration `env:"DELETION_TASKS_RETENTION" yaml:"deletion_tasks_retention" envDefault:"1h"`
+	// AdminToken токен доступа к административным методам API (заголовок Authorization: Bearer <токен>). Пустое значение - методы недоступны
+	AdminToken string `env:"ADMIN_TOKEN" yaml:"admin_token"`
+	// ShortenJobsDir каталог для файлов фоновых задач сокращения ссылок. Пустое значение - системный каталог временных файлов
+	ShortenJobsDir string `env:"SHORTEN_JOBS_DIR" yaml:"shorten_jobs_dir"`
+	// ShortenJobsRetention сколько времени хранятся статус и результат завершенной фоновой задачи сокращения ссылок. 0 - до перезапуска сервиса
+	ShortenJobsRetention time.Duration `env:"SHORTEN_JOBS_RETENTION" yaml:"shorten_jobs_retention" envDefault:"24h"`
+	// ShortenJobsPerUser сколько фоновых задач сокращения ссылок (вместе с хранимыми завершенными) может быть у пользователя
+	ShortenJobsPerUser int `env:"SHORTEN_JOBS_PER_USER" yaml:"shorten_jobs_per_user" envDefault:"10"`
+	// ShortenJobsMaxRequestSize максимальный размер тела запроса фоновой задачи сокращения ссылок в байтах, больше - ответ 413
+	ShortenJobsMaxRequestSize int64 `env:"SHORTEN_JOBS_MAX_REQUEST_SIZE" yaml:"shorten_jobs_max_request_size" envDefault:"67108864"`
 }
 
 func GetConfig() (*Config, error) {
@@ -22,20 +81,144 @@ func GetConfig() (*Config, error) {
 	if err != nil {
 		return nil, fmt.Errorf("configuration failure: failed to parse environment. %w", err)
 	}
+	envCfg := *cfg
 
 	// объявляем флаги, дефолтными значениями указываем то, что уже в конфиге (заполнено из env-переменных). Таким образом:
 	// - если не передан ни флаг, ни установлена переменная окружения - используется envDefault заданный в структурных тегах
 	// - если передана переменная окружения, но не передан флаг - будет использоваться значение переменной окружения
 	// - если передан флаг - он оверрайдит и дефолты и значения переменных окружения
-	flag.StringVar(&cfg.ServerAddress, "a", cfg.ServerAddress, "Server address. If not set in CLI or env variable SERVER_ADDRESS defaults to ':8080'")
-	flag.StringVar(&cfg.BaseURL, "b", cfg.BaseURL, "Base URL. If not set in CLI or env variable BASE_URL defaults to http://localhost:8080")
-	flag.StringVar(&cfg.StorageFilePath, "f", cfg.StorageFilePath, "File repository path. If not set in CLI or env variable FILE_STORAGE_PATH repository will be non-persistent")
-	flag.StringVar(&cfg.DatabaseDSN, "d", cfg.DatabaseDSN, "Database DSN. If not set in CLI or env variable DATABASE_DSN db is not used")
-	flag.IntVar(&cfg.ShortenBatchSize, "shorten-batch-size", cfg.ShortenBatchSize, "Batch size for shorten. If not set in CLI or env variable SHORTEN_BATCH_SIZE defaults to 100")
-	flag.IntVar(&cfg.ShortURLIdentifierLength, "url-id-length", cfg.ShortURLIdentifierLength, "Short url id length. If not set in CLI or env variable URL_ID_LENGTH defaults to 10")
-
+	declareFlags(flag.CommandLine, cfg)
 	flag.Parse()
 
+	var fileKeys map[string]interface{}
+	if cfg.ConfigFile != "" {
+		if cfg, fileKeys, err = loadLayered(cfg.ConfigFile, envCfg, os.Args[1:]); err != nil {
+			return nil, err
+		}
+	}
+	if err = cfg.complete(fileKeys); err != nil {
+		return nil, err
+	}
+
 	return cfg, nil
+}
+
+// complete применяет умолчания, зависящие от других настроек, и проверяет конфигурацию. fileKeys - ключи, заданные в файле конфигурации
+func (cfg *Config) complete(fileKeys map[string]interface{}) error {
+	// дефолтный BaseURL должен вести на тот же протокол, на котором работает сервер
+	_, baseURLInFile := fileKeys["base_url"]
+	if cfg.EnableHTTPS && !baseURLInFile && !isBaseURLSet() {
+		cfg.BaseURL = "https://" + strings.TrimPrefix(cfg.BaseURL, "http://")
+	}
+	return cfg.Validate()
+}
 
+func declareFlags(fs *flag.FlagSet, cfg *Config) {
+	fs.StringVar(&cfg.ConfigFile, "c", cfg.ConfigFile, "Configuration file (JSON or YAML). If not set in CLI or env variable CONFIG only env variables and CLI flags are used")
+	fs.StringVar(&cfg.ServerAddress, "a", cfg.ServerAddress, "Server address. If not set in CLI or env variable SERVER_ADDRESS defaults to ':8080'")
+	fs.StringVar(&cfg.BaseURL, "b", cfg.BaseURL, "Base URL. If not set in CLI or env variable BASE_URL defaults to http://localhost:8080")
+	fs.StringVar(&cfg.StorageFilePath, "f", cfg.StorageFilePath, "File repository path. If not set in CLI or env variable FILE_STORAGE_PATH repository will be non-persistent")
+	fs.BoolVar(&cfg.EnableHTTPS, "s", cfg.EnableHTTPS, "Enable HTTPS. If not set in CLI or env variable ENABLE_HTTPS server uses HTTP")
+	fs.StringVar(&cfg.TLSCertFile, "tls-cert", cfg.TLSCertFile, "TLS certificate file. If not set in CLI or env variable TLS_CERT_FILE defaults to cert.pem. Self-signed certificate is generated if neither certificate nor key exists")
+	fs.StringVar(&cfg.TLSKeyFile, "tls-key", cfg.TLSKeyFile, "TLS key file. If not set in CLI or env variable TLS_KEY_FILE defaults to key.pem")
+	fs.StringVar(&cfg.DatabaseDSN, "d", cfg.DatabaseDSN, "Database DSN. If not set in CLI or env variable DATABASE_DSN db is not used")
+	fs.IntVar(&cfg.ShortenBatchSize, "shorten-batch-size", cfg.ShortenBatchSize, "Batch size for shorten. If not set in CLI or env variable SHORTEN_BATCH_SIZE defaults to 100")
+	fs.IntVar(&cfg.ShortURLIdentifierLength, "url-id-length", cfg.ShortURLIdentifierLength, "Short url id length. If not set in CLI or env variable URL_ID_LENGTH defaults to 10")
+	fs.StringVar(&cfg.URLIDGenerator, "url-id-generator", cfg.URLIDGenerator, "Short url id generator: random, secure, sequential or hash. If not set in CLI or env variable URL_ID_GENERATOR defaults to secure")
+	fs.StringVar(&cfg.URLIDAlphabet, "url-id-alphabet", cfg.URLIDAlphabet, "Characters used by secure short url id generator. If not set in CLI or env variable URL_ID_ALPHABET latin letters and digits are used")
+	fs.StringVar(&cfg.URLIDObfuscationKey, "url-id-obfuscation-key", cfg.URLIDObfuscationKey, "Key for obfuscating sequential short url ids. If not set in CLI or env variable URL_ID_OBFUSCATION_KEY ids are not obfuscated")
+	fs.StringVar(&cfg.URLIDHashKey, "url-id-hash-key", cfg.URLIDHashKey, "Key for hashing urls by hash short url id generator. If not set in CLI or env variable URL_ID_HASH_KEY it is derived from auth secret key")
+	fs.StringVar(&cfg.URLUniquenessScope, "url-uniqueness-scope", cfg.URLUniquenessScope, "Original url uniqueness scope: global, user or none. If not set in CLI or env variable URL_UNIQUENESS_SCOPE defaults to global")
+	fs.BoolVar(&cfg.MigrateURLUniquenessScope, "migrate-url-uniqueness-scope", cfg.MigrateURLUniquenessScope, "Allow changing original url uniqueness scope stored in db to the configured one. If not set in CLI or env variable MIGRATE_URL_UNIQUENESS_SCOPE service fails to start when they differ")
+	fs.IntVar(&cfg.ShortenMaxAttempts, "shorten-max-attempts", cfg.ShortenMaxAttempts, "Max attempts to store url with generated id on id collisions. If not set in CLI or env variable SHORTEN_MAX_ATTEMPTS defaults to 5")
+	fs.StringVar(&cfg.LogLevel, "log-level", cfg.LogLevel, "Log level: trace, debug, info, warn, error, fatal, panic or disabled. If not set in CLI or env variable LOG_LEVEL defaults to info")
+	fs.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", cfg.ShutdownTimeout, "How long to wait for in-flight requests and background tasks on shutdown. If not set in CLI or env variable SHUTDOWN_TIMEOUT defaults to 30s")
+	fs.DurationVar(&cfg.ExpiredURLsPurgeInterval, "expired-purge-interval", cfg.ExpiredURLsPurgeInterval, "Expired urls purge interval. If not set in CLI or env variable EXPIRED_URLS_PURGE_INTERVAL defaults to 1h. 0 disables purging")
+	fs.DurationVar(&cfg.ExpiredURLsRetention, "expired-retention", cfg.ExpiredURLsRetention, "How long expired urls are kept before purging. If not set in CLI or env variable EXPIRED_URLS_RETENTION defaults to 168h")
+	fs.DurationVar(&cfg.DeletedURLsPurgeInterval, "deleted-purge-interval", cfg.DeletedURLsPurgeInterval, "Deleted urls purge interval. If not set in CLI or env variable DELETED_URLS_PURGE_INTERVAL defaults to 1h. 0 disables purging")
+	fs.DurationVar(&cfg.DeletedURLsRetention, "deleted-retention", cfg.DeletedURLsRetention, "How long deleted urls are kept before purging. If not set in CLI or env variable DELETED_URLS_RETENTION defaults to 720h")
+	fs.IntVar(&cfg.DeleteBatchSize, "delete-batch-size", cfg.DeleteBatchSize, "How many urls of a user are accumulated before deleting them at once. If not set in CLI or env variable DELETE_BATCH_SIZE defaults to 100")
+	fs.DurationVar(&cfg.DeleteFlushInterval, "delete-flush-interval", cfg.DeleteFlushInterval, "How long delete requests are accumulated. If not set in CLI or env variable DELETE_FLUSH_INTERVAL defaults to 200ms")
+	fs.IntVar(&cfg.DeleteWorkers, "delete-workers", cfg.DeleteWorkers, "How many url deletions run concurrently. If not set in CLI or env variable DELETE_WORKERS defaults to 5")
+	fs.IntVar(&cfg.DeleteMaxAttempts, "delete-max-attempts", cfg.DeleteMaxAttempts, "Max attempts to delete urls on repository errors. If not set in CLI or env variable DELETE_MAX_ATTEMPTS defaults to 3")
+	fs.DurationVar(&cfg.DeletionTasksRetention, "deletion-tasks-retention", cfg.DeletionTasksRetention, "How long finished url deletion tasks are kept. If not set in CLI or env variable DELETION_TASKS_RETENTION defaults to 1h")
+	fs.StringVar(&cfg.AdminToken, "admin-token", cfg.AdminToken, "Admin API access token. If not set in CLI or env variable ADMIN_TOKEN admin API is disabled")
+	fs.StringVar(&cfg.ShortenJobsDir, "shorten-jobs-dir", cfg.ShortenJobsDir, "Directory for background shorten jobs files. If not set in CLI or env variable SHORTEN_JOBS_DIR system temp directory is used")
+	fs.DurationVar(&cfg.ShortenJobsRetention, "shorten-jobs-retention", cfg.ShortenJobsRetention, "How long finished shorten jobs and their results are kept. If not set in CLI or env variable SHORTEN_JOBS_RETENTION defaults to 24h")
+	fs.IntVar(&cfg.ShortenJobsPerUser, "shorten-jobs-per-user", cfg.ShortenJobsPerUser, "Max background shorten jobs of a user including kept finished ones. If not set in CLI or env variable SHORTEN_JOBS_PER_USER defaults to 10")
+	fs.Int64Var(&cfg.ShortenJobsMaxRequestSize, "shorten-jobs-max-request-size", cfg.ShortenJobsMaxRequestSize, "Max background shorten job request body size in bytes. If not set in CLI or env variable SHORTEN_JOBS_MAX_REQUEST_SIZE defaults to 67108864 (64 MiB)")
+
+}
+
+// loadLayered собирает конфигурацию из умолчаний, файла path, переменных окружения (уже разобранных в envCfg) и флагов args.
+// Возвращает также ключи, заданные в файле
+func loadLayered(path string, envCfg Config, args []string) (*Config, map[string]interface{}, error) {
+	cfg := &Config{}
+	// только умолчания из структурных тегов
+	if err := env.Parse(cfg, env.Options{Environment: map[string]string{}}); err != nil {
+		return nil, nil, fmt.Errorf("configuration failure: failed to set defaults. %w", err)
+	}
+	fileKeys, err := loadFile(path, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	overrideFromEnv(cfg, &envCfg)
+
+	// флаги уже проверены при первом разборе, здесь они только переносятся поверх файла и окружения
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	declareFlags(fs, cfg)
+	if err = fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	cfg.ConfigFile = path
+	return cfg, fileKeys, nil
+}
+
+// loadFile читает в cfg файл конфигурации. JSON - подмножество YAML, поэтому оба формата разбираются одинаково.
+// Длительности задаются строками вида "1h30m". Неизвестные ключи считаются ошибкой
+func loadFile(path string, cfg *Config) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("configuration failure: failed to read config file. %w", err)
+	}
+	keys := make(map[string]interface{})
+	if err = yaml.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("configuration failure: failed to parse config file %s. %w", path, err)
+	}
+	dec := yaml.NewDecoder(strings.NewReader(string(data)))
+	dec.KnownFields(true)
+	if err = dec.Decode(cfg); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("configuration failure: failed to parse config file %s. %w", path, err)
+	}
+	return keys, nil
+}
+
+// overrideFromEnv переносит из envCfg в cfg значения полей, переменные окружения которых установлены
+func overrideFromEnv(cfg *Config, envCfg *Config) {
+	dst := reflect.ValueOf(cfg).Elem()
+	src := reflect.ValueOf(envCfg).Elem()
+	for i := 0; i < dst.NumField(); i++ {
+		name, ok := dst.Type().Field(i).Tag.Lookup("env")
+		if !ok {
+			continue
+		}
+		if _, set := os.LookupEnv(name); set {
+			dst.Field(i).Set(src.Field(i))
+		}
+	}
+}
+
+// isBaseURLSet задан ли BaseURL явно - переменной окружения или флагом
+func isBaseURLSet() bool {
+	if _, ok := os.LookupEnv("BASE_URL"); ok {
+		return true
+	}
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "b" {
+			set = true
+		}
+	})
+	return set
 }
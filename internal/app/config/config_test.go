@@ -0,0 +1,227 @@
+package config
+
+import (
+	"errors"
+	"github.com/caarlos0/env/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_loadLayered(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		content  string
+	}{
+		{
+			name:     "should load yaml",
+			filename: "config.yaml",
+			content: `
+base_url: http://short.example
+shorten_batch_size: 50
+url_id_length: 12
+delete_flush_interval: 1s
+`,
+		},
+		{
+			name:     "should load json",
+			filename: "config.json",
+			content:  `{"base_url": "http://short.example", "shorten_batch_size": 50, "url_id_length": 12, "delete_flush_interval": "1s"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.filename)
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0600))
+			t.Setenv("SHORTEN_BATCH_SIZE", "70")
+			envCfg := Config{}
+			require.NoError(t, env.Parse(&envCfg))
+
+			cfg, fileKeys, err := loadLayered(path, envCfg, []string{"-url-id-length", "8"})
+			require.NoError(t, err)
+
+			assert.Equal(t, ":8080", cfg.ServerAddress, "default should be used when not set anywhere")
+			assert.Equal(t, "http://short.example", cfg.BaseURL, "file should override default")
+			assert.Equal(t, time.Second, cfg.DeleteFlushInterval, "file should override default")
+			assert.Equal(t, 70, cfg.ShortenBatchSize, "env should override file")
+			assert.Equal(t, 8, cfg.ShortURLIdentifierLength, "flag should override file")
+			assert.Equal(t, path, cfg.ConfigFile)
+			assert.Contains(t, fileKeys, "base_url")
+		})
+	}
+}
+
+func Test_loadLayered_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{
+			name:    "should fail on unknown key",
+			content: `shorten_batch: 50`,
+		},
+		{
+			name:    "should fail on invalid value",
+			content: `delete_flush_interval: soon`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0600))
+			_, _, err := loadLayered(path, Config{}, nil)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func Test_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(cfg *Config)
+		fields []string
+	}{
+		{
+			name:   "should accept defaults",
+			modify: func(cfg *Config) {},
+		},
+		{
+			name: "should list every invalid field",
+			modify: func(cfg *Config) {
+				cfg.ShortenBatchSize = 0
+				cfg.ShortURLIdentifierLength = 100
+				cfg.BaseURL = "localhost:8080"
+				cfg.URLIDGenerator = "uuid"
+				cfg.DeletedURLsRetention = -time.Hour
+				cfg.URLIDAlphabet = "abc/"
+			},
+			fields: []string{"ShortenBatchSize", "ShortURLIdentifierLength", "BaseURL", "URLIDGenerator", "URLIDAlphabet", "DeletedURLsRetention"},
+		},
+		{
+			name: "should reject url id alphabet with duplicates",
+			modify: func(cfg *Config) {
+				cfg.URLIDAlphabet = "abca"
+			},
+			fields: []string{"URLIDAlphabet"},
+		},
+		{
+			name: "should reject url id alphabet with dot",
+			modify: func(cfg *Config) {
+				cfg.URLIDAlphabet = "ab."
+			},
+			fields: []string{"URLIDAlphabet"},
+		},
+		{
+			name: "should reject single character url id alphabet",
+			modify: func(cfg *Config) {
+				cfg.URLIDAlphabet = "a"
+			},
+			fields: []string{"URLIDAlphabet"},
+		},
+		{
+			name: "should accept url safe url id alphabet",
+			modify: func(cfg *Config) {
+				cfg.URLIDAlphabet = "abc-_~"
+			},
+		},
+		{
+			name: "should reject hash generator with non-global uniqueness scope",
+			modify: func(cfg *Config) {
+				cfg.URLIDGenerator = "hash"
+				cfg.URLUniquenessScope = "user"
+			},
+			fields: []string{"URLUniquenessScope"},
+		},
+		{
+			name: "should accept hash generator with global uniqueness scope",
+			modify: func(cfg *Config) {
+				cfg.URLIDGenerator = "hash"
+				cfg.URLUniquenessScope = "global"
+			},
+		},
+		{
+			name: "should require tls files when https is enabled",
+			modify: func(cfg *Config) {
+				cfg.EnableHTTPS = true
+				cfg.TLSCertFile = ""
+			},
+			fields: []string{"TLSCertFile"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{}
+			require.NoError(t, env.Parse(cfg, env.Options{Environment: map[string]string{}}))
+			tt.modify(cfg)
+
+			err := cfg.Validate()
+			if len(tt.fields) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			var validationErr *ValidationError
+			require.True(t, errors.As(err, &validationErr))
+			fields := make([]string, 0, len(validationErr.Fields))
+			for _, f := range validationErr.Fields {
+				fields = append(fields, f.Field)
+				assert.Contains(t, err.Error(), f.Field)
+			}
+			assert.ElementsMatch(t, tt.fields, fields)
+		})
+	}
+}
+
+func Test_diff(t *testing.T) {
+	current := Config{BaseURL: "http://localhost:8080", ShortenBatchSize: 100, LogLevel: "info", DatabaseDSN: "postgres://db"}
+	tests := []struct {
+		name    string
+		modify  func(cfg *Config)
+		changes []Change
+		wantErr bool
+	}{
+		{
+			name:   "should report nothing when unchanged",
+			modify: func(cfg *Config) {},
+		},
+		{
+			name: "should report reloadable changes",
+			modify: func(cfg *Config) {
+				cfg.BaseURL = "https://short.example"
+				cfg.LogLevel = "debug"
+			},
+			changes: []Change{
+				{Field: "BaseURL", Old: "http://localhost:8080", New: "https://short.example"},
+				{Field: "LogLevel", Old: "info", New: "debug"},
+			},
+		},
+		{
+			name: "should reject storage change",
+			modify: func(cfg *Config) {
+				cfg.ShortenBatchSize = 50
+				cfg.DatabaseDSN = ""
+				cfg.StorageFilePath = "/tmp/urls"
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := current
+			tt.modify(&next)
+			changes, err := diff(current, next)
+			if tt.wantErr {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "DatabaseDSN")
+				assert.Contains(t, err.Error(), "StorageFilePath")
+				assert.NotContains(t, err.Error(), "ShortenBatchSize")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.changes, changes)
+		})
+	}
+}
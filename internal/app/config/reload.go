@@ -0,0 +1,74 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"github.com/caarlos0/env/v6"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// reloadableFields настройки, которые можно изменить без перезапуска сервиса
+var reloadableFields = map[string]struct{}{
+	"BaseURL":                  {},
+	"ShortenBatchSize":         {},
+	"DeleteBatchSize":          {},
+	"ShortURLIdentifierLength": {},
+	"LogLevel":                 {},
+}
+
+// Change изменение значения настройки при перезагрузке конфигурации
+type Change struct {
+	Field string
+	Old   interface{}
+	New   interface{}
+}
+
+// Reload заново собирает конфигурацию из файла current.ConfigFile, переменных окружения и флагов запуска.
+// Если изменились настройки, которые нельзя применить без перезапуска (хранилище, адрес сервера и т.д.), возвращает ошибку со списком этих настроек
+func Reload(current Config) (Config, []Change, error) {
+	if current.ConfigFile == "" {
+		return current, nil, errors.New("configuration file is not set")
+	}
+	envCfg := Config{}
+	if err := env.Parse(&envCfg); err != nil {
+		return current, nil, fmt.Errorf("configuration failure: failed to parse environment. %w", err)
+	}
+	next, fileKeys, err := loadLayered(current.ConfigFile, envCfg, os.Args[1:])
+	if err != nil {
+		return current, nil, err
+	}
+	if err = next.complete(fileKeys); err != nil {
+		return current, nil, err
+	}
+
+	changes, err := diff(current, *next)
+	if err != nil {
+		return current, nil, err
+	}
+	return *next, changes, nil
+}
+
+// diff возвращает изменения настроек от current к next. Если изменились настройки не из reloadableFields - возвращает ошибку
+func diff(current Config, next Config) ([]Change, error) {
+	var changes []Change
+	var unsafe []string
+	cur := reflect.ValueOf(current)
+	nxt := reflect.ValueOf(next)
+	for i := 0; i < cur.NumField(); i++ {
+		if reflect.DeepEqual(cur.Field(i).Interface(), nxt.Field(i).Interface()) {
+			continue
+		}
+		field := cur.Type().Field(i).Name
+		if _, ok := reloadableFields[field]; !ok {
+			unsafe = append(unsafe, field)
+			continue
+		}
+		changes = append(changes, Change{Field: field, Old: cur.Field(i).Interface(), New: nxt.Field(i).Interface()})
+	}
+	if len(unsafe) > 0 {
+		return nil, fmt.Errorf("settings can not be changed without restart: %s", strings.Join(unsafe, ", "))
+	}
+	return changes, nil
+}
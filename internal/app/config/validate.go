@@ -0,0 +1,169 @@
+package config
+
+import (
+	"fmt"
+	"github.com/rs/zerolog"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// допустимая длина идентификатора ссылки. Генератор hash дает идентификаторы не длиннее 43 символов
+const (
+	minURLIDLength = 4
+	maxURLIDLength = 40
+)
+
+var (
+	urlIDGenerators     = []string{"random", "secure", "sequential", "hash"}
+	urlUniquenessScopes = []string{"global", "user", "none"}
+)
+
+// urlIDAlphabetChars символы, допустимые в алфавите идентификаторов, те же, что проверяет генератор secure:
+// не требующие экранирования в пути url, кроме точки (идентификаторы "." и ".." нормализуются как сегменты пути)
+const urlIDAlphabetChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_~"
+
+// FieldError недопустимое значение поля конфигурации
+type FieldError struct {
+	Field  string
+	Reason string
+}
+
+// ValidationError ошибки всех недопустимых полей конфигурации
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("invalid configuration:")
+	for _, f := range e.Fields {
+		sb.WriteString(fmt.Sprintf("\n\t%s: %s", f.Field, f.Reason))
+	}
+	return sb.String()
+}
+
+func (e *ValidationError) add(field string, format string, args ...interface{}) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Reason: fmt.Sprintf(format, args...)})
+}
+
+// Validate проверяет значения всех полей конфигурации. Если есть недопустимые - возвращает *ValidationError со всеми ними
+func (cfg *Config) Validate() error {
+	errs := &ValidationError{}
+
+	if cfg.ServerAddress == "" {
+		errs.add("ServerAddress", "must not be empty")
+	}
+	if u, err := url.Parse(cfg.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs.add("BaseURL", "must be absolute http or https url, got %q", cfg.BaseURL)
+	}
+	if cfg.AuthSecretKey == "" {
+		errs.add("AuthSecretKey", "must not be empty")
+	}
+	if cfg.EnableHTTPS {
+		if cfg.TLSCertFile == "" {
+			errs.add("TLSCertFile", "must not be empty when https is enabled")
+		}
+		if cfg.TLSKeyFile == "" {
+			errs.add("TLSKeyFile", "must not be empty when https is enabled")
+		}
+	}
+
+	positive := []struct {
+		field string
+		value int
+	}{
+		{"ShortenBatchSize", cfg.ShortenBatchSize},
+		{"ShortenMaxAttempts", cfg.ShortenMaxAttempts},
+		{"DeleteBatchSize", cfg.DeleteBatchSize},
+		{"DeleteWorkers", cfg.DeleteWorkers},
+		{"DeleteMaxAttempts", cfg.DeleteMaxAttempts},
+		{"ShortenJobsPerUser", cfg.ShortenJobsPerUser},
+	}
+	for _, f := range positive {
+		if f.value <= 0 {
+			errs.add(f.field, "must be positive, got %d", f.value)
+		}
+	}
+	if cfg.ShortenJobsMaxRequestSize <= 0 {
+		errs.add("ShortenJobsMaxRequestSize", "must be positive, got %d", cfg.ShortenJobsMaxRequestSize)
+	}
+	if cfg.ShortURLIdentifierLength < minURLIDLength || cfg.ShortURLIdentifierLength > maxURLIDLength {
+		errs.add("ShortURLIdentifierLength", "must be between %d and %d, got %d", minURLIDLength, maxURLIDLength, cfg.ShortURLIdentifierLength)
+	}
+	if !contains(urlIDGenerators, cfg.URLIDGenerator) {
+		errs.add("URLIDGenerator", "must be one of %s, got %q", strings.Join(urlIDGenerators, ", "), cfg.URLIDGenerator)
+	}
+	// пустой алфавит - алфавит по умолчанию
+	if cfg.URLIDAlphabet != "" {
+		if reason := checkURLIDAlphabet(cfg.URLIDAlphabet); reason != "" {
+			errs.add("URLIDAlphabet", "%s, got %q", reason, cfg.URLIDAlphabet)
+		}
+	}
+	if !contains(urlUniquenessScopes, cfg.URLUniquenessScope) {
+		errs.add("URLUniquenessScope", "must be one of %s, got %q", strings.Join(urlUniquenessScopes, ", "), cfg.URLUniquenessScope)
+	} else if cfg.URLIDGenerator == "hash" && cfg.URLUniquenessScope != "global" {
+		// hash дает одной ссылке один идентификатор, поэтому повторное сокращение ссылки другим пользователем (или тем же при none) всегда приводит к конфликту идентификаторов
+		errs.add("URLUniquenessScope", "must be global when url id generator is hash, got %q", cfg.URLUniquenessScope)
+	}
+
+	if _, err := zerolog.ParseLevel(cfg.LogLevel); err != nil || cfg.LogLevel == "" {
+		errs.add("LogLevel", "unknown log level %q", cfg.LogLevel)
+	}
+
+	if cfg.ShutdownTimeout <= 0 {
+		errs.add("ShutdownTimeout", "must be positive, got %s", cfg.ShutdownTimeout)
+	}
+	if cfg.DeleteFlushInterval <= 0 {
+		errs.add("DeleteFlushInterval", "must be positive, got %s", cfg.DeleteFlushInterval)
+	}
+	// для остальных длительностей 0 означает, что соответствующая очистка не запускается (или хранение до перезапуска)
+	nonNegative := []struct {
+		field string
+		value time.Duration
+	}{
+		{"ExpiredURLsPurgeInterval", cfg.ExpiredURLsPurgeInterval},
+		{"ExpiredURLsRetention", cfg.ExpiredURLsRetention},
+		{"DeletedURLsPurgeInterval", cfg.DeletedURLsPurgeInterval},
+		{"DeletedURLsRetention", cfg.DeletedURLsRetention},
+		{"DeletionTasksRetention", cfg.DeletionTasksRetention},
+		{"ShortenJobsRetention", cfg.ShortenJobsRetention},
+	}
+	for _, f := range nonNegative {
+		if f.value < 0 {
+			errs.add(f.field, "must not be negative, got %s", f.value)
+		}
+	}
+
+	if len(errs.Fields) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// checkURLIDAlphabet возвращает причину, по которой алфавит идентификаторов недопустим, или пустую строку
+func checkURLIDAlphabet(alphabet string) string {
+	seen := make(map[rune]struct{}, len(alphabet))
+	for _, c := range alphabet {
+		if !strings.ContainsRune(urlIDAlphabetChars, c) {
+			return fmt.Sprintf("must contain only latin letters, digits and -_~, %q is not allowed", c)
+		}
+		if _, ok := seen[c]; ok {
+			return fmt.Sprintf("must not contain duplicate characters, %q is repeated", c)
+		}
+		seen[c] = struct{}{}
+	}
+	if len(seen) < 2 {
+		return "must contain at least 2 characters"
+	}
+	return ""
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
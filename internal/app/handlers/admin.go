@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type purgeDeletedResponse struct {
+	Purged int `json:"purged"`
+}
+
+// AdminAuthenticator пропускает только запросы с заголовком Authorization: Bearer <AdminToken>.
+// Если токен не задан в конфигурации - административные методы недоступны
+func (s *Service) AdminAuthenticator(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.Config().AdminToken == "" {
+			http.NotFound(w, r)
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.Config().AdminToken)) != 1 {
+			log.Info().Str("path", r.URL.Path).Msg("invalid admin token")
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// PurgeDeletedURLsHandler окончательно удаляет ссылки, удаленные более чем retention назад.
+// retention передается параметром запроса (например, ?retention=24h), по умолчанию - DeletedURLsRetention из конфигурации
+func (s *Service) PurgeDeletedURLsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		retention := s.Config().DeletedURLsRetention
+		if param := r.URL.Query().Get("retention"); param != "" {
+			var err error
+			if retention, err = time.ParseDuration(param); err != nil || retention < 0 {
+				http.Error(w, fmt.Sprintf("Invalid retention %s", param), http.StatusBadRequest)
+				return
+			}
+		}
+
+		purged, err := s.Repository.PurgeDeleted(r.Context(), time.Now().Add(-retention))
+		if err != nil {
+			log.Error().Err(err).Msg("error while purging deleted urls")
+			http.Error(w, "Could not purge deleted urls", http.StatusInternalServerError)
+			return
+		}
+		log.Info().Int("count", purged).Dur("retention", retention).Msg("deleted urls purged by admin")
+
+		writeJSONResponse(w, http.StatusOK, purgeDeletedResponse{Purged: purged})
+	}
+}
@@ -0,0 +1,94 @@
+package handlers_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/config"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/handlers"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/repository/mocks"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+var _ = Describe("PurgeDeletedURLs", func() {
+	var ts *httptest.Server
+	var urlRepositoryMock *mocks.URLRepository
+	var cfg config.Config
+
+	BeforeEach(func() {
+		urlRepositoryMock = new(mocks.URLRepository)
+		cfg = config.Config{
+			BaseURL:              "http://localhost:8080",
+			DeletedURLsRetention: 24 * time.Hour,
+			AdminToken:           "admin secret",
+		}
+	})
+	JustBeforeEach(func() {
+		service := handlers.NewService(urlRepositoryMock, nil, cfg)
+		ts = httptest.NewServer(handlers.NewRouter(service))
+	})
+	AfterEach(func() {
+		ts.Close()
+	})
+
+	purge := func(query string, token string) (int, string) {
+		req, err := http.NewRequest("POST", ts.URL+"/api/admin/urls/purge"+query, nil)
+		Expect(err).NotTo(HaveOccurred())
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		res, err := http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return res.StatusCode, string(body)
+	}
+	purgedBefore := func(retention time.Duration) interface{} {
+		return mock.MatchedBy(func(before time.Time) bool {
+			expected := time.Now().Add(-retention)
+			return before.After(expected.Add(-time.Minute)) && !before.After(expected)
+		})
+	}
+
+	It("should purge urls deleted before configured retention", func() {
+		urlRepositoryMock.On("PurgeDeleted", mock.Anything, purgedBefore(24*time.Hour)).Return(3, nil).Once()
+		status, body := purge("", "admin secret")
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(body).To(MatchJSON(`{"purged": 3}`))
+		urlRepositoryMock.AssertExpectations(GinkgoT())
+	})
+
+	It("should use retention from query", func() {
+		urlRepositoryMock.On("PurgeDeleted", mock.Anything, purgedBefore(0)).Return(5, nil).Once()
+		status, body := purge("?retention=0s", "admin secret")
+		Expect(status).To(Equal(http.StatusOK))
+		Expect(body).To(MatchJSON(`{"purged": 5}`))
+		urlRepositoryMock.AssertExpectations(GinkgoT())
+	})
+
+	It("should respond 400 on invalid retention", func() {
+		status, _ := purge("?retention=week", "admin secret")
+		Expect(status).To(Equal(http.StatusBadRequest))
+	})
+
+	It("should respond 403 on invalid token", func() {
+		status, _ := purge("", "wrong")
+		Expect(status).To(Equal(http.StatusForbidden))
+		urlRepositoryMock.AssertNotCalled(GinkgoT(), "PurgeDeleted", mock.Anything, mock.Anything)
+	})
+
+	When("admin token is not configured", func() {
+		BeforeEach(func() {
+			cfg.AdminToken = ""
+		})
+
+		It("should respond 404", func() {
+			status, _ := purge("", "")
+			Expect(status).To(Equal(http.StatusNotFound))
+		})
+	})
+})
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/shortener"
+	"regexp"
+)
+
+var (
+	errInvalidAlias  = errors.New("alias must be 1-64 characters long and contain only latin letters, digits, '-' and '_'")
+	errReservedAlias = errors.New("alias is reserved")
+)
+
+var aliasPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// validateAlias проверяет, что пользовательский идентификатор ссылки допустим
+func validateAlias(alias string) error {
+	if !aliasPattern.MatchString(alias) {
+		return errInvalidAlias
+	}
+	if shortener.IsReservedURLID(alias) {
+		return errReservedAlias
+	}
+	return nil
+}
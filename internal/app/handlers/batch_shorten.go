@@ -3,6 +3,7 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/rs/zerolog/log"
 	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/middlewares/cookieauth"
@@ -14,18 +15,40 @@ import (
 )
 
 type batchShortenRequestEntity struct {
-	OriginalURL   string `json:"original_url"`
-	CorrelationID string `json:"correlation_id"`
+	OriginalURL   string     `json:"original_url"`
+	CorrelationID string     `json:"correlation_id"`
+	Alias         string     `json:"alias,omitempty"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	TTL           int64      `json:"ttl,omitempty"`
 }
+
+// статусы сохранения отдельной ссылки в пакетном запросе
+const (
+	batchItemCreated  = "created"
+	batchItemExists   = "exists"
+	batchItemInvalid  = "invalid"
+	batchItemConflict = "conflict"
+)
+
 type batchShortenResponseEntity struct {
 	CorrelationID string `json:"correlation_id"`
-	ShortURL      string `json:"short_url"`
+	ShortURL      string `json:"short_url,omitempty"`
+	Status        string `json:"status"`
+	Error         string `json:"error,omitempty"`
 }
 
 type batchShortenRequest []batchShortenRequestEntity
 
+// BatchShortenURLHandler сокращает список ссылок. Ссылки обрабатываются независимо: ошибка в одной из них не мешает сохранить остальные,
+// результат по каждой ссылке возвращается в ответе.
+// Код ответа: 201 - сохранена хотя бы одна ссылка, 409 - ни одна не сохранена и есть конфликты, 400 - все ссылки некорректны.
+// Запрос с Content-Type application/x-ndjson обрабатывается потоково, см. streamBatchShorten
 func (s *Service) BatchShortenURLHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if isNDJSONRequest(r) {
+			s.streamBatchShorten(w, r)
+			return
+		}
 		bodyContent, err := io.ReadAll(r.Body)
 		defer r.Body.Close()
 		if err != nil {
@@ -45,44 +68,14 @@ func (s *Service) BatchShortenURLHandler() http.HandlerFunc {
 		if err = json.Unmarshal(bodyContent, &req); err != nil {
 			log.Info().Err(err).Msg("invalid json")
 			http.Error(w, "Invalid json", http.StatusBadRequest)
-		}
-
-		if isValid, invalidURL := isValidRequest(req); !isValid {
-			log.Info().Err(err).Msg("invalid url" + invalidURL)
-			http.Error(w, "invalid url"+invalidURL, http.StatusBadRequest)
 			return
 		}
 
 		ctx, cancel := context.WithTimeout(r.Context(), time.Minute)
 		defer cancel()
-		batch := repository.NewBatchURLEntityStoreService(s.Config.ShortenBatchSize, s.Repository)
-
-		resp := make([]batchShortenResponseEntity, len(req))
-
-		for idx, reqEntity := range req {
-			id := s.IDGenerator.GenerateURLID(reqEntity.OriginalURL)
-			entity := repository.URLEntity{
-				ID:          id,
-				OriginalURL: reqEntity.OriginalURL,
-				UserID:      userID,
-			}
-			err = batch.Add(ctx, entity)
-			if err != nil {
-				log.Error().Err(err).Msg("error in batch.add")
-				http.Error(w, "internal server error", http.StatusInternalServerError)
-				return
-			}
-			resp[idx] = batchShortenResponseEntity{
-				CorrelationID: reqEntity.CorrelationID,
-				ShortURL:      fmt.Sprintf("%s/%s", s.Config.BaseURL, id),
-			}
-		}
-		// по комменту из ревью (сделай через defer func() { err := batch.Flush(ctx)}, так у тебя добавиться больше опций и если где-то ты добавишь return, то у тебя Flush все равно сработает)
-		// flush-то сработает, но ошибку мы уже не поймаем, и на клиент не отдадим 500 (попробовал, тестом поймал что в таком случае при отказе репозитория - клиенту отдается 201 типа все в порядке)
-		// так что оставляю так
-		err = batch.Flush(ctx)
+		resp, err := s.shortenBatch(ctx, userID, req)
 		if err != nil {
-			log.Error().Err(err).Msg("error while batch.flush")
+			log.Error().Err(err).Msg("error while shortening batch")
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			return
 		}
@@ -91,10 +84,11 @@ func (s *Service) BatchShortenURLHandler() http.HandlerFunc {
 		if err != nil {
 			log.Error().Err(err).Msg("can't serialize response")
 			http.Error(w, "Can't serialize response", http.StatusInternalServerError)
+			return
 		}
 
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusCreated)
+		w.WriteHeader(batchResponseStatus(resp))
 
 		_, err = w.Write(serializedResp)
 		if err != nil {
@@ -104,14 +98,130 @@ func (s *Service) BatchShortenURLHandler() http.HandlerFunc {
 	}
 }
 
-func isValidRequest(req batchShortenRequest) (isValid bool, firstInvalidURL string) {
-	for _, entity := range req {
-		if !isValidURL(entity.OriginalURL) {
-			return false, entity.OriginalURL
+// shortenBatch сокращает список ссылок пользователя userID и возвращает результат по каждой ссылке.
+// Ошибка возвращается, только если не удалось обработать список целиком
+func (s *Service) shortenBatch(ctx context.Context, userID string, req batchShortenRequest) ([]batchShortenResponseEntity, error) {
+	resp := make([]batchShortenResponseEntity, len(req))
+	// items[idx] == nil - ссылка не прошла проверку и не сохраняется
+	items := make([]*repository.BatchItem, len(req))
+	aliases := make(map[string]struct{})
+	now := time.Now()
+	for idx, reqEntity := range req {
+		expiresAt, err := validateBatchItem(reqEntity, aliases, now)
+		if err != nil {
+			log.Info().Err(err).Str("correlationID", reqEntity.CorrelationID).Msg("invalid batch item")
+			resp[idx] = batchShortenResponseEntity{
+				CorrelationID: reqEntity.CorrelationID,
+				Status:        batchItemInvalid,
+				Error:         err.Error(),
+			}
+			continue
+		}
+		if reqEntity.Alias != "" {
+			aliases[reqEntity.Alias] = struct{}{}
+		}
+		items[idx] = &repository.BatchItem{
+			Entity: repository.URLEntity{
+				ID:          reqEntity.Alias,
+				OriginalURL: s.normalizeURL(reqEntity.OriginalURL),
+				UserID:      userID,
+				ExpiresAt:   expiresAt,
+			},
 		}
 	}
 
-	return true, ""
+	batch := repository.NewBatchURLEntityStoreService(s.Config().ShortenBatchSize, s.Repository, s.batchIDRegenerator(aliases))
+
+	for _, item := range items {
+		if item == nil {
+			continue
+		}
+		if item.Entity.ID == "" {
+			var err error
+			if item.Entity.ID, err = s.generateURLID(ctx, item.Entity.OriginalURL, 0); err != nil {
+				return nil, fmt.Errorf("error while generating url id: %w", err)
+			}
+		}
+		if err := batch.Add(ctx, item); err != nil {
+			return nil, err
+		}
+	}
+	// по комменту из ревью (сделай через defer func() { err := batch.Flush(ctx)}, так у тебя добавиться больше опций и если где-то ты добавишь return, то у тебя Flush все равно сработает)
+	// flush-то сработает, но ошибку мы уже не поймаем, и на клиент не отдадим 500 (попробовал, тестом поймал что в таком случае при отказе репозитория - клиенту отдается 201 типа все в порядке)
+	// так что оставляю так
+	if err := batch.Flush(ctx); err != nil {
+		return nil, err
+	}
+
+	// идентификаторы могут измениться при сохранении из-за коллизий, поэтому ответ формируем после сохранения всех ссылок
+	for idx, item := range items {
+		if item != nil {
+			resp[idx] = s.batchItemResult(req[idx], item)
+		}
+	}
+	return resp, nil
+}
+
+// validateBatchItem проверяет ссылку из пакетного запроса и возвращает срок ее действия.
+// aliases - пользовательские идентификаторы предыдущих ссылок запроса, для проверки на повторы
+func validateBatchItem(entity batchShortenRequestEntity, aliases map[string]struct{}, now time.Time) (*time.Time, error) {
+	if !isValidURL(entity.OriginalURL) {
+		return nil, fmt.Errorf("invalid url %s", entity.OriginalURL)
+	}
+	if entity.Alias != "" {
+		if err := validateAlias(entity.Alias); err != nil {
+			return nil, fmt.Errorf("invalid alias %s: %w", entity.Alias, err)
+		}
+		if _, ok := aliases[entity.Alias]; ok {
+			return nil, fmt.Errorf("duplicate alias %s", entity.Alias)
+		}
+	}
+	expiresAt, err := resolveExpiration(entity.ExpiresAt, entity.TTL, now)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expiration: %w", err)
+	}
+	return expiresAt, nil
+}
+
+// batchItemResult формирует результат по ссылке после сохранения пакета
+func (s *Service) batchItemResult(reqEntity batchShortenRequestEntity, item *repository.BatchItem) batchShortenResponseEntity {
+	result := batchShortenResponseEntity{CorrelationID: reqEntity.CorrelationID}
+
+	var errExists *repository.ErrURLExists
+	var errIDConflict *repository.ErrURLIDConflict
+	switch {
+	case item.Err == nil:
+		result.Status = batchItemCreated
+		result.ShortURL = fmt.Sprintf("%s/%s", s.Config().BaseURL, item.Entity.ID)
+	case errors.As(item.Err, &errExists):
+		result.Status = batchItemExists
+		result.ShortURL = fmt.Sprintf("%s/%s", s.Config().BaseURL, errExists.ID)
+		result.Error = "url is already shortened"
+	case errors.As(item.Err, &errIDConflict) && reqEntity.Alias != "":
+		result.Status = batchItemConflict
+		result.Error = fmt.Sprintf("alias %s is already taken", reqEntity.Alias)
+	default:
+		result.Status = batchItemConflict
+		result.Error = "could not generate unique short url id"
+	}
+	return result
+}
+
+// batchResponseStatus возвращает код ответа по результатам сохранения ссылок
+func batchResponseStatus(resp []batchShortenResponseEntity) int {
+	if len(resp) == 0 {
+		return http.StatusCreated
+	}
+	status := http.StatusBadRequest
+	for _, item := range resp {
+		switch item.Status {
+		case batchItemCreated:
+			return http.StatusCreated
+		case batchItemExists, batchItemConflict:
+			status = http.StatusConflict
+		}
+	}
+	return status
 }
 
 func isValidURL(input string) bool {
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/middlewares/cookieauth"
+	"mime"
+	"net/http"
+)
+
+const ndjsonContentType = "application/x-ndjson"
+
+// maxNDJSONLineSize максимальная длина строки в потоковом запросе
+const maxNDJSONLineSize = 1 << 20
+
+// batchItemError статус строки ответа, сообщающей, что обработка потока прервана из-за внутренней ошибки
+const batchItemError = "error"
+
+func isNDJSONRequest(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == ndjsonContentType
+}
+
+// streamBatchShorten сокращает ссылки из запроса в формате NDJSON (одна batchShortenRequestEntity на строку).
+// Результат по каждой ссылке отправляется отдельной строкой сразу после сохранения ее части списка.
+// Так как ответ начинается до обработки всего списка, код ответа всегда 200, результат нужно смотреть в статусах строк.
+// Строка, которую не удалось разобрать, отмечается некорректной и не прерывает обработку
+func (s *Service) streamBatchShorten(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	userID, err := cookieauth.FromContext(r.Context())
+	if err != nil {
+		log.Info().Err(err).Msg("unauthorized")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	started := false
+	shortener := s.newBatchStreamShortener(userID, func(_ batchShortenRequest, results []batchShortenResponseEntity) error {
+		if !started {
+			w.Header().Set("Content-Type", ndjsonContentType)
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		for _, item := range results {
+			if err := enc.Encode(item); err != nil {
+				return err
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+
+	err = s.shortenNDJSON(r, shortener)
+	if err == nil {
+		err = shortener.Flush(r.Context())
+	}
+	if err != nil {
+		log.Error().Err(err).Int("received", shortener.Received()).Msg("error while streaming batch shorten")
+		if !started {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		// код ответа уже отправлен, сообщаем об ошибке последней строкой
+		if err = enc.Encode(batchShortenResponseEntity{Status: batchItemError, Error: "internal server error"}); err != nil {
+			log.Error().Err(err).Msg("write response failed")
+		}
+		return
+	}
+	if !started {
+		// пустой запрос
+		w.Header().Set("Content-Type", ndjsonContentType)
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (s *Service) shortenNDJSON(r *http.Request, shortener *batchStreamShortener) error {
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxNDJSONLineSize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var reqEntity batchShortenRequestEntity
+		if err := json.Unmarshal(scanner.Bytes(), &reqEntity); err != nil {
+			log.Info().Err(err).Int("line", line).Msg("invalid json line")
+			if err = shortener.Reject(r.Context(), "", fmt.Errorf("invalid json on line %d", line)); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := shortener.Add(r.Context(), reqEntity); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
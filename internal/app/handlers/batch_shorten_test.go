@@ -6,6 +6,7 @@ import (
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/config"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/repository"
 	repositoryMocks "github.com/thorgnir-go-study/go-musthave-shortener/internal/app/repository/mocks"
 	shortenerMocks "github.com/thorgnir-go-study/go-musthave-shortener/internal/app/shortener/mocks"
 	"io"
@@ -48,22 +49,214 @@ func Test_BatchShortenURLHandler(t *testing.T) {
 				contentType: "application/json; charset=utf-8",
 				statusCode:  http.StatusCreated,
 				body: `[
-{"short_url":"http://localhost:8080/shortGoogle", "correlation_id": "1"},
-{"short_url":"http://localhost:8080/shortYandex", "correlation_id": "2"}
+{"short_url":"http://localhost:8080/shortGoogle", "correlation_id": "1", "status": "created"},
+{"short_url":"http://localhost:8080/shortYandex", "correlation_id": "2", "status": "created"}
 ]`,
 			},
 			storage: func() *repositoryMocks.URLRepository {
 				urlStorage := new(repositoryMocks.URLRepository)
-				urlStorage.On("StoreBatch", mock.Anything, mock.Anything).Return(nil).Once()
+				urlStorage.On("StoreBatch", mock.Anything, mock.Anything).Return([]error{nil, nil}, nil).Once()
 				return urlStorage
 			}(),
 			idGenerator: func() *shortenerMocks.URLIDGenerator {
 				gen := new(shortenerMocks.URLIDGenerator)
-				gen.On("GenerateURLID", "http://google.com").Return("shortGoogle").Once()
-				gen.On("GenerateURLID", "http://yandex.ru").Return("shortYandex").Once()
+				gen.On("GenerateURLID", mock.Anything, "http://google.com", mock.Anything).Return("shortGoogle", nil).Once()
+				gen.On("GenerateURLID", mock.Anything, "http://yandex.ru", mock.Anything).Return("shortYandex", nil).Once()
 				return gen
 			}(),
 		},
+		{
+			name: "should shorten with aliases",
+			request: request{
+				url:    "/api/shorten/batch",
+				method: http.MethodPost,
+				body: `[
+{"original_url": "http://google.com", "correlation_id": "1", "alias": "google"},
+{"original_url": "http://yandex.ru", "correlation_id": "2"}
+]`,
+			},
+			want: want{
+				contentType: "application/json; charset=utf-8",
+				statusCode:  http.StatusCreated,
+				body: `[
+{"short_url":"http://localhost:8080/google", "correlation_id": "1", "status": "created"},
+{"short_url":"http://localhost:8080/shortYandex", "correlation_id": "2", "status": "created"}
+]`,
+			},
+			storage: func() *repositoryMocks.URLRepository {
+				urlStorage := new(repositoryMocks.URLRepository)
+				urlStorage.On("StoreBatch", mock.Anything, mock.Anything).Return([]error{nil, nil}, nil).Once()
+				return urlStorage
+			}(),
+			idGenerator: func() *shortenerMocks.URLIDGenerator {
+				gen := new(shortenerMocks.URLIDGenerator)
+				gen.On("GenerateURLID", mock.Anything, "http://yandex.ru", mock.Anything).Return("shortYandex", nil).Once()
+				return gen
+			}(),
+		},
+		{
+			name: "should regenerate id on collision",
+			request: request{
+				url:    "/api/shorten/batch",
+				method: http.MethodPost,
+				body: `[
+{"original_url": "http://google.com", "correlation_id": "1"},
+{"original_url": "http://yandex.ru", "correlation_id": "2"}
+]`,
+			},
+			want: want{
+				contentType: "application/json; charset=utf-8",
+				statusCode:  http.StatusCreated,
+				body: `[
+{"short_url":"http://localhost:8080/shortGoogle", "correlation_id": "1", "status": "created"},
+{"short_url":"http://localhost:8080/otherYandex", "correlation_id": "2", "status": "created"}
+]`,
+			},
+			storage: func() *repositoryMocks.URLRepository {
+				urlStorage := new(repositoryMocks.URLRepository)
+				urlStorage.On("StoreBatch", mock.Anything, mock.MatchedBy(func(b []repository.URLEntity) bool {
+					return len(b) == 2 && b[1].ID == "shortYandex"
+				})).Return([]error{nil, repository.NewErrURLIDConflict("shortYandex")}, nil).Once()
+				// повторно сохраняется только ссылка с новым идентификатором
+				urlStorage.On("StoreBatch", mock.Anything, mock.MatchedBy(func(b []repository.URLEntity) bool {
+					return len(b) == 1 && b[0].ID == "otherYandex"
+				})).Return([]error{nil}, nil).Once()
+				return urlStorage
+			}(),
+			idGenerator: func() *shortenerMocks.URLIDGenerator {
+				gen := new(shortenerMocks.URLIDGenerator)
+				gen.On("GenerateURLID", mock.Anything, "http://google.com", mock.Anything).Return("shortGoogle", nil).Once()
+				gen.On("GenerateURLID", mock.Anything, "http://yandex.ru", mock.Anything).Return("shortYandex", nil).Once()
+				gen.On("GenerateURLID", mock.Anything, "http://yandex.ru", mock.Anything).Return("otherYandex", nil).Once()
+				return gen
+			}(),
+		},
+		{
+			name: "should respond 409 when alias is taken",
+			request: request{
+				url:    "/api/shorten/batch",
+				method: http.MethodPost,
+				body: `[
+{"original_url": "http://google.com", "correlation_id": "1", "alias": "google"}
+]`,
+			},
+			want: want{
+				contentType: "application/json; charset=utf-8",
+				statusCode:  http.StatusConflict,
+				body: `[
+{"correlation_id": "1", "status": "conflict", "error": "alias google is already taken"}
+]`,
+			},
+			storage: func() *repositoryMocks.URLRepository {
+				urlStorage := new(repositoryMocks.URLRepository)
+				urlStorage.On("StoreBatch", mock.Anything, mock.Anything).Return([]error{repository.NewErrURLIDConflict("google")}, nil).Once()
+				return urlStorage
+			}(),
+		},
+		{
+			name: "should respond 409 when url already exists",
+			request: request{
+				url:    "/api/shorten/batch",
+				method: http.MethodPost,
+				body: `[
+{"original_url": "http://google.com", "correlation_id": "1"}
+]`,
+			},
+			want: want{
+				contentType: "application/json; charset=utf-8",
+				statusCode:  http.StatusConflict,
+				body: `[
+{"short_url":"http://localhost:8080/existingGoogle", "correlation_id": "1", "status": "exists", "error": "url is already shortened"}
+]`,
+			},
+			storage: func() *repositoryMocks.URLRepository {
+				urlStorage := new(repositoryMocks.URLRepository)
+				urlStorage.On("StoreBatch", mock.Anything, mock.Anything).Return([]error{repository.NewErrURLExists("existingGoogle")}, nil).Once()
+				return urlStorage
+			}(),
+			idGenerator: func() *shortenerMocks.URLIDGenerator {
+				gen := new(shortenerMocks.URLIDGenerator)
+				gen.On("GenerateURLID", mock.Anything, "http://google.com", mock.Anything).Return("shortGoogle", nil).Once()
+				return gen
+			}(),
+		},
+		{
+			name: "should reject duplicate alias and store the rest",
+			request: request{
+				url:    "/api/shorten/batch",
+				method: http.MethodPost,
+				body: `[
+{"original_url": "http://google.com", "correlation_id": "1", "alias": "same"},
+{"original_url": "http://yandex.ru", "correlation_id": "2", "alias": "same"}
+]`,
+			},
+			want: want{
+				contentType: "application/json; charset=utf-8",
+				statusCode:  http.StatusCreated,
+				body: `[
+{"short_url":"http://localhost:8080/same", "correlation_id": "1", "status": "created"},
+{"correlation_id": "2", "status": "invalid", "error": "duplicate alias same"}
+]`,
+			},
+			storage: func() *repositoryMocks.URLRepository {
+				urlStorage := new(repositoryMocks.URLRepository)
+				urlStorage.On("StoreBatch", mock.Anything, mock.MatchedBy(func(b []repository.URLEntity) bool {
+					return len(b) == 1 && b[0].ID == "same"
+				})).Return([]error{nil}, nil).Once()
+				return urlStorage
+			}(),
+		},
+		{
+			name: "should report invalid url and store the rest",
+			request: request{
+				url:    "/api/shorten/batch",
+				method: http.MethodPost,
+				body: `[
+{"original_url": "http://google.com", "correlation_id": "1"},
+{"original_url": "some text", "correlation_id": "2"},
+{"original_url": "http://yandex.ru", "correlation_id": "3"}
+]`,
+			},
+			want: want{
+				contentType: "application/json; charset=utf-8",
+				statusCode:  http.StatusCreated,
+				body: `[
+{"short_url":"http://localhost:8080/shortGoogle", "correlation_id": "1", "status": "created"},
+{"correlation_id": "2", "status": "invalid", "error": "invalid url some text"},
+{"short_url":"http://localhost:8080/existingYandex", "correlation_id": "3", "status": "exists", "error": "url is already shortened"}
+]`,
+			},
+			storage: func() *repositoryMocks.URLRepository {
+				urlStorage := new(repositoryMocks.URLRepository)
+				urlStorage.On("StoreBatch", mock.Anything, mock.Anything).Return([]error{nil, repository.NewErrURLExists("existingYandex")}, nil).Once()
+				return urlStorage
+			}(),
+			idGenerator: func() *shortenerMocks.URLIDGenerator {
+				gen := new(shortenerMocks.URLIDGenerator)
+				gen.On("GenerateURLID", mock.Anything, "http://google.com", mock.Anything).Return("shortGoogle", nil).Once()
+				gen.On("GenerateURLID", mock.Anything, "http://yandex.ru", mock.Anything).Return("shortYandex", nil).Once()
+				return gen
+			}(),
+		},
+		{
+			name: "should respond 400 when all urls are invalid",
+			request: request{
+				url:    "/api/shorten/batch",
+				method: http.MethodPost,
+				body: `[
+{"original_url": "/blabla", "correlation_id": "1"},
+{"original_url": "http://yandex.ru", "correlation_id": "2", "ttl": -1}
+]`,
+			},
+			want: want{
+				contentType: "application/json; charset=utf-8",
+				statusCode:  http.StatusBadRequest,
+				body: `[
+{"correlation_id": "1", "status": "invalid", "error": "invalid url /blabla"},
+{"correlation_id": "2", "status": "invalid", "error": "invalid expiration: ttl must be positive"}
+]`,
+			},
+		},
 		{
 			name: "should fail on empty body",
 			request: request{
@@ -118,13 +311,13 @@ func Test_BatchShortenURLHandler(t *testing.T) {
 			},
 			storage: func() *repositoryMocks.URLRepository {
 				urlStorage := new(repositoryMocks.URLRepository)
-				urlStorage.On("StoreBatch", mock.Anything, mock.Anything).Return(errors.New("some error")).Once()
+				urlStorage.On("StoreBatch", mock.Anything, mock.Anything).Return(nil, errors.New("some error")).Once()
 				return urlStorage
 			}(),
 			idGenerator: func() *shortenerMocks.URLIDGenerator {
 				gen := new(shortenerMocks.URLIDGenerator)
-				gen.On("GenerateURLID", "http://google.com").Return("shortGoogle").Once()
-				gen.On("GenerateURLID", "http://yandex.ru").Return("shortYandex").Once()
+				gen.On("GenerateURLID", mock.Anything, "http://google.com", mock.Anything).Return("shortGoogle", nil).Once()
+				gen.On("GenerateURLID", mock.Anything, "http://yandex.ru", mock.Anything).Return("shortYandex", nil).Once()
 				return gen
 			}(),
 		},
@@ -142,8 +335,9 @@ func Test_BatchShortenURLHandler(t *testing.T) {
 				gen = new(shortenerMocks.URLIDGenerator)
 			}
 			cfg := config.Config{
-				BaseURL:          baseURL,
-				ShortenBatchSize: 100,
+				BaseURL:            baseURL,
+				ShortenBatchSize:   100,
+				ShortenMaxAttempts: 3,
 			}
 
 			service := NewService(st, gen, cfg)
@@ -153,7 +347,7 @@ func Test_BatchShortenURLHandler(t *testing.T) {
 			res := testRequest(t, ts, tt.request.method, tt.request.url, strings.NewReader(tt.request.body))
 
 			assert.Equal(t, tt.want.statusCode, res.StatusCode)
-			if res.StatusCode == http.StatusCreated {
+			if tt.want.body != "" {
 				assert.Equal(t, tt.want.contentType, res.Header.Get("Content-Type"))
 				body, err := io.ReadAll(res.Body)
 				defer res.Body.Close()
@@ -165,3 +359,57 @@ func Test_BatchShortenURLHandler(t *testing.T) {
 	}
 
 }
+
+func Test_BatchShortenURLHandler_NDJSON(t *testing.T) {
+	st := new(repositoryMocks.URLRepository)
+	// ссылки сохраняются частями по ShortenBatchSize, некорректная строка не прерывает обработку
+	st.On("StoreBatch", mock.Anything, mock.MatchedBy(func(b []repository.URLEntity) bool {
+		return len(b) == 2 && b[0].ID == "shortGoogle" && b[1].ID == "shortYandex"
+	})).Return([]error{nil, nil}, nil).Once()
+	st.On("StoreBatch", mock.Anything, mock.MatchedBy(func(b []repository.URLEntity) bool {
+		return len(b) == 1 && b[0].ID == "shortYa"
+	})).Return([]error{repository.NewErrURLExists("existingYa")}, nil).Once()
+	gen := new(shortenerMocks.URLIDGenerator)
+	gen.On("GenerateURLID", mock.Anything, "http://google.com", mock.Anything).Return("shortGoogle", nil).Once()
+	gen.On("GenerateURLID", mock.Anything, "http://yandex.ru", mock.Anything).Return("shortYandex", nil).Once()
+	gen.On("GenerateURLID", mock.Anything, "http://ya.ru", mock.Anything).Return("shortYa", nil).Once()
+	cfg := config.Config{
+		BaseURL:            "http://localhost:8080",
+		ShortenBatchSize:   2,
+		ShortenMaxAttempts: 3,
+	}
+
+	service := NewService(st, gen, cfg)
+	ts := httptest.NewServer(NewRouter(service))
+	defer ts.Close()
+
+	body := `{"original_url": "http://google.com", "correlation_id": "1"}
+{"original_url": "http://yandex.ru", "correlation_id": "2"}
+not a json
+
+{"original_url": "http://ya.ru", "correlation_id": "3"}
+`
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/shorten/batch", strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "application/x-ndjson", res.Header.Get("Content-Type"))
+	respBody, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(respBody)), "\n")
+	expected := []string{
+		`{"short_url":"http://localhost:8080/shortGoogle", "correlation_id": "1", "status": "created"}`,
+		`{"short_url":"http://localhost:8080/shortYandex", "correlation_id": "2", "status": "created"}`,
+		`{"correlation_id": "", "status": "invalid", "error": "invalid json on line 3"}`,
+		`{"short_url":"http://localhost:8080/existingYa", "correlation_id": "3", "status": "exists", "error": "url is already shortened"}`,
+	}
+	require.Len(t, lines, len(expected))
+	for idx, line := range lines {
+		assert.JSONEq(t, expected[idx], line)
+	}
+	st.AssertExpectations(t)
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"time"
+)
+
+// batchStreamShortener сокращает ссылки, поступающие потоком, частями по ShortenBatchSize ссылок,
+// чтобы не держать весь список в памяти. Результаты по каждой части передаются в emit в порядке поступления ссылок
+type batchStreamShortener struct {
+	service *Service
+	userID  string
+	chunk   batchShortenRequest
+	emit    batchResultsEmitter
+	// processed сколько ссылок уже передано в emit
+	processed int
+}
+
+// batchResultsEmitter получает часть списка ссылок и результаты по ним, results[idx] соответствует req[idx]
+type batchResultsEmitter func(req batchShortenRequest, results []batchShortenResponseEntity) error
+
+func (s *Service) newBatchStreamShortener(userID string, emit batchResultsEmitter) *batchStreamShortener {
+	chunkSize := s.Config().ShortenBatchSize
+	if chunkSize < 1 {
+		chunkSize = 1
+	}
+	return &batchStreamShortener{
+		service: s,
+		userID:  userID,
+		chunk:   make(batchShortenRequest, 0, chunkSize),
+		emit:    emit,
+	}
+}
+
+func (b *batchStreamShortener) Add(ctx context.Context, entity batchShortenRequestEntity) error {
+	b.chunk = append(b.chunk, entity)
+	if cap(b.chunk) == len(b.chunk) {
+		return b.Flush(ctx)
+	}
+	return nil
+}
+
+// Reject отмечает некорректной ссылку, которую не удалось даже разобрать. Накопленные ссылки сокращаются раньше, чтобы не нарушить порядок результатов
+func (b *batchStreamShortener) Reject(ctx context.Context, correlationID string, reason error) error {
+	if err := b.Flush(ctx); err != nil {
+		return err
+	}
+	b.processed++
+	return b.emit(batchShortenRequest{{CorrelationID: correlationID}}, []batchShortenResponseEntity{{
+		CorrelationID: correlationID,
+		Status:        batchItemInvalid,
+		Error:         reason.Error(),
+	}})
+}
+
+// Flush сокращает накопленные ссылки. Каждая часть обрабатывается со своим таймаутом, так как весь поток может обрабатываться долго
+func (b *batchStreamShortener) Flush(ctx context.Context) error {
+	if len(b.chunk) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	results, err := b.service.shortenBatch(ctx, b.userID, b.chunk)
+	if err != nil {
+		return err
+	}
+	b.processed += len(b.chunk)
+	err = b.emit(b.chunk, results)
+	b.chunk = b.chunk[:0]
+	return err
+}
+
+// Received количество ссылок, полученных из потока, включая еще не сокращенные
+func (b *batchStreamShortener) Received() int {
+	return b.processed + len(b.chunk)
+}
@@ -2,13 +2,17 @@ package handlers
 
 import (
 	"encoding/json"
+	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/middlewares/cookieauth"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/repository"
 	"io"
 	"net/http"
+	"time"
 )
 
-// DeleteURLsHandler обрабатывает запросы на удаление ссылок
+// DeleteURLsHandler принимает запрос на удаление ссылок. Ссылки удаляются в фоне, в ответе 202 - задача удаления,
+// адрес ее статуса - в заголовке Location
 func (s *Service) DeleteURLsHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		bodyContent, err := io.ReadAll(r.Body)
@@ -22,6 +26,7 @@ func (s *Service) DeleteURLsHandler() http.HandlerFunc {
 		if err = json.Unmarshal(bodyContent, &ids); err != nil {
 			log.Info().Err(err).Msg("invalid json")
 			http.Error(w, "Invalid json", http.StatusBadRequest)
+			return
 		}
 
 		userID, err := cookieauth.FromContext(r.Context())
@@ -31,12 +36,39 @@ func (s *Service) DeleteURLsHandler() http.HandlerFunc {
 			return
 		}
 
-		s.deleteURLsReqCh <- deleteURLsRequest{
-			ids:    ids,
+		task := &deletionTask{
+			id:     uuid.NewString(),
 			userID: userID,
+			ids:    ids,
+			status: deletionTaskPending,
 		}
+		if s.DeletionQueue != nil {
+			err = s.DeletionQueue.EnqueueDeletion(r.Context(), repository.DeletionRequest{
+				ID:        task.id,
+				UserID:    userID,
+				URLIDs:    ids,
+				CreatedAt: time.Now().UTC(),
+			})
+			if err != nil {
+				log.Error().Err(err).Msg("could not enqueue url deletion")
+				http.Error(w, "Could not enqueue url deletion", http.StatusInternalServerError)
+				return
+			}
+		}
+		s.deletionTasks.add(task)
+		s.deleteURLsInbox.push(task)
 
+		serializedResp, err := json.Marshal(task.statusResponse())
+		if err != nil {
+			log.Error().Err(err).Msg("can't serialize response")
+			http.Error(w, "Can't serialize response", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Location", s.deletionTaskURL(task.id))
 		w.WriteHeader(http.StatusAccepted)
-
+		if _, err = w.Write(serializedResp); err != nil {
+			log.Error().Err(err).Msg("write response failed")
+		}
 	}
 }
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/middlewares/cookieauth"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// статусы задачи удаления ссылок
+const (
+	deletionTaskPending = "pending"
+	deletionTaskDone    = "done"
+	deletionTaskFailed  = "failed"
+)
+
+// deletionTask запрос на удаление ссылок, выполняемый в фоне
+type deletionTask struct {
+	id     string
+	userID string
+	ids    []string
+
+	mx      sync.RWMutex
+	status  string
+	deleted []string
+	err     string
+	// cancelled ссылки, восстановленные до выполнения задачи. Они не удаляются
+	cancelled map[string]struct{}
+}
+
+type deletionTaskStatusResponse struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	// Deleted ссылки пользователя из запроса, помеченные удаленными. Остальные не найдены или принадлежат другим пользователям
+	Deleted []string `json:"deleted,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+func (t *deletionTask) finish(deleted []string, err error) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	if err != nil {
+		t.status = deletionTaskFailed
+		t.err = err.Error()
+		return
+	}
+	t.status = deletionTaskDone
+	t.deleted = deleted
+}
+
+// cancel исключает ссылки ids из еще не выполненной задачи
+func (t *deletionTask) cancel(ids []string) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	if t.status != deletionTaskPending {
+		return
+	}
+	if t.cancelled == nil {
+		t.cancelled = make(map[string]struct{}, len(ids))
+	}
+	for _, id := range ids {
+		t.cancelled[id] = struct{}{}
+	}
+}
+
+func (t *deletionTask) isCancelled(id string) bool {
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	_, ok := t.cancelled[id]
+	return ok
+}
+
+func (t *deletionTask) statusResponse() deletionTaskStatusResponse {
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+	resp := deletionTaskStatusResponse{
+		ID:      t.id,
+		Status:  t.status,
+		Deleted: t.deleted,
+		Error:   t.err,
+	}
+	// у завершенной задачи список выводится всегда, даже пустой
+	if t.status == deletionTaskDone && resp.Deleted == nil {
+		resp.Deleted = []string{}
+	}
+	return resp
+}
+
+// deletionTaskStore задачи хранятся только в памяти, после перезапуска сервиса их статус теряется
+type deletionTaskStore struct {
+	mx    sync.RWMutex
+	tasks map[string]*deletionTask
+}
+
+func newDeletionTaskStore() *deletionTaskStore {
+	return &deletionTaskStore{tasks: make(map[string]*deletionTask)}
+}
+
+func (s *deletionTaskStore) add(task *deletionTask) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.tasks[task.id] = task
+}
+
+// get возвращает задачу, только если она принадлежит пользователю userID
+func (s *deletionTaskStore) get(id string, userID string) (*deletionTask, bool) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	task, ok := s.tasks[id]
+	if !ok || task.userID != userID {
+		return nil, false
+	}
+	return task, true
+}
+
+// pendingOf возвращает невыполненные задачи пользователя userID
+func (s *deletionTaskStore) pendingOf(userID string) []*deletionTask {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	var tasks []*deletionTask
+	for _, task := range s.tasks {
+		if task.userID != userID {
+			continue
+		}
+		task.mx.RLock()
+		pending := task.status == deletionTaskPending
+		task.mx.RUnlock()
+		if pending {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks
+}
+
+func (s *deletionTaskStore) remove(id string) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	delete(s.tasks, id)
+}
+
+// finishDeletionTask сохраняет результат удаления и через DeletionTasksRetention удаляет задачу
+func (s *Service) finishDeletionTask(task *deletionTask, deleted []string, err error) {
+	task.finish(deleted, err)
+	if s.Config().DeletionTasksRetention <= 0 {
+		return
+	}
+	time.AfterFunc(s.Config().DeletionTasksRetention, func() {
+		s.deletionTasks.remove(task.id)
+	})
+}
+
+func (s *Service) deletionTaskURL(id string) string {
+	return fmt.Sprintf("%s/api/user/urls/deletions/%s", s.Config().BaseURL, id)
+}
+
+// DeletionTaskStatusHandler возвращает статус задачи удаления ссылок. Чужие задачи не отличаются от несуществующих
+func (s *Service) DeletionTaskStatusHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := cookieauth.FromContext(r.Context())
+		if err != nil {
+			log.Info().Err(err).Msg("unauthorized")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		task, ok := s.deletionTasks.get(chi.URLParam(r, "taskID"), userID)
+		if !ok {
+			http.Error(w, "Task not found", http.StatusNotFound)
+			return
+		}
+
+		serializedResp, err := json.Marshal(task.statusResponse())
+		if err != nil {
+			log.Error().Err(err).Msg("can't serialize response")
+			http.Error(w, "Can't serialize response", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		if _, err = w.Write(serializedResp); err != nil {
+			log.Error().Err(err).Msg("write response failed")
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/config"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/handlers"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/repository"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/repository/mocks"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+)
+
+var _ = Describe("DeletionTasks", func() {
+	var ts *httptest.Server
+	var urlRepositoryMock *mocks.URLRepository
+	var cookie *http.Cookie
+	var userID string
+
+	BeforeEach(func() {
+		urlRepositoryMock = new(mocks.URLRepository)
+		cfg := config.Config{BaseURL: "http://localhost:8080"}
+
+		service := handlers.NewService(urlRepositoryMock, nil, cfg)
+		r := handlers.NewRouter(service)
+		ts = httptest.NewServer(r)
+
+		urlRepositoryMock.On("LoadByUserID", mock.Anything, mock.Anything).Return([]repository.URLEntity{}, nil).Once()
+		res := testGetList(ts, nil)
+		cookie = res.Cookies()[0]
+		userID = strings.Split(cookie.Value, ":")[0]
+	})
+	AfterEach(func() {
+		ts.Close()
+	})
+
+	deleteURLs := func(body string) string {
+		res := testRequest(ts, "DELETE", "/api/user/urls", []*http.Cookie{cookie}, strings.NewReader(body))
+		defer res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusAccepted))
+		var status map[string]interface{}
+		Expect(json.NewDecoder(res.Body).Decode(&status)).To(Succeed())
+		Expect(res.Header.Get("Location")).To(Equal("http://localhost:8080/api/user/urls/deletions/" + status["id"].(string)))
+		return status["id"].(string)
+	}
+	taskStatus := func(id string) map[string]interface{} {
+		res := testRequest(ts, "GET", "/api/user/urls/deletions/"+id, []*http.Cookie{cookie}, nil)
+		defer res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusOK))
+		var status map[string]interface{}
+		Expect(json.NewDecoder(res.Body).Decode(&status)).To(Succeed())
+		return status
+	}
+
+	It("should report deleted urls", func() {
+		urlRepositoryMock.On("DeleteURLs", mock.Anything, userID, []string{"123", "456", "789"}).Return([]string{"123", "789"}, nil).Once()
+		id := deleteURLs(`["123", "456", "789"]`)
+		Eventually(func() interface{} { return taskStatus(id)["status"] }).Should(Equal("done"))
+		Expect(taskStatus(id)).To(HaveKeyWithValue("deleted", ConsistOf("123", "789")))
+	})
+
+	It("should report repository error", func() {
+		urlRepositoryMock.On("DeleteURLs", mock.Anything, userID, []string{"123"}).Return(nil, errors.New("db is down")).Once()
+		id := deleteURLs(`["123"]`)
+		Eventually(func() interface{} { return taskStatus(id)["status"] }).Should(Equal("failed"))
+		Expect(taskStatus(id)).To(HaveKeyWithValue("error", "db is down"))
+	})
+
+	It("should respond 400 on invalid json", func() {
+		res := testRequest(ts, "DELETE", "/api/user/urls", []*http.Cookie{cookie}, strings.NewReader(`{"id": "123"}`))
+		defer res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusBadRequest))
+	})
+
+	When("task belongs to another user", func() {
+		It("should respond 404", func() {
+			urlRepositoryMock.On("DeleteURLs", mock.Anything, userID, []string{"123"}).Return([]string{"123"}, nil).Once()
+			id := deleteURLs(`["123"]`)
+			res := testRequest(ts, "GET", "/api/user/urls/deletions/"+id, nil, nil)
+			defer res.Body.Close()
+			Expect(res.StatusCode).To(Equal(http.StatusNotFound))
+		})
+	})
+})
+
+var _ = Describe("DeleteURLsCoalescing", func() {
+	var ts *httptest.Server
+	var urlRepositoryMock *mocks.URLRepository
+	var cookie *http.Cookie
+	var userID string
+
+	BeforeEach(func() {
+		urlRepositoryMock = new(mocks.URLRepository)
+		cfg := config.Config{
+			BaseURL:             "http://localhost:8080",
+			DeleteBatchSize:     3,
+			DeleteFlushInterval: 300 * time.Millisecond,
+			DeleteWorkers:       1,
+			DeleteMaxAttempts:   2,
+		}
+
+		service := handlers.NewService(urlRepositoryMock, nil, cfg)
+		ts = httptest.NewServer(handlers.NewRouter(service))
+
+		urlRepositoryMock.On("LoadByUserID", mock.Anything, mock.Anything).Return([]repository.URLEntity{}, nil).Once()
+		res := testGetList(ts, nil)
+		cookie = res.Cookies()[0]
+		userID = strings.Split(cookie.Value, ":")[0]
+	})
+	AfterEach(func() {
+		ts.Close()
+	})
+
+	deleteURLs := func(body string) string {
+		res := testRequest(ts, "DELETE", "/api/user/urls", []*http.Cookie{cookie}, strings.NewReader(body))
+		defer res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusAccepted))
+		var status map[string]interface{}
+		Expect(json.NewDecoder(res.Body).Decode(&status)).To(Succeed())
+		return status["id"].(string)
+	}
+	taskStatus := func(id string) map[string]interface{} {
+		res := testRequest(ts, "GET", "/api/user/urls/deletions/"+id, []*http.Cookie{cookie}, nil)
+		defer res.Body.Close()
+		var status map[string]interface{}
+		Expect(json.NewDecoder(res.Body).Decode(&status)).To(Succeed())
+		return status
+	}
+
+	It("should delete urls of several requests at once", func() {
+		urlRepositoryMock.On("DeleteURLs", mock.Anything, userID, []string{"1", "2"}).Return([]string{"1", "2"}, nil).Once()
+		first := deleteURLs(`["1"]`)
+		second := deleteURLs(`["2", "1"]`)
+		Eventually(func() interface{} { return taskStatus(second)["status"] }).Should(Equal("done"))
+		Expect(taskStatus(first)).To(HaveKeyWithValue("deleted", ConsistOf("1")))
+		Expect(taskStatus(second)).To(HaveKeyWithValue("deleted", ConsistOf("2", "1")))
+		urlRepositoryMock.AssertExpectations(GinkgoT())
+	})
+
+	It("should delete without waiting when batch size is reached", func() {
+		urlRepositoryMock.On("DeleteURLs", mock.Anything, userID, []string{"1", "2", "3"}).Return([]string{"1", "3"}, nil).Once()
+		id := deleteURLs(`["1", "2", "3"]`)
+		Eventually(func() interface{} { return taskStatus(id)["status"] }, 200*time.Millisecond, 10*time.Millisecond).Should(Equal("done"))
+		Expect(taskStatus(id)).To(HaveKeyWithValue("deleted", ConsistOf("1", "3")))
+	})
+
+	It("should retry on repository error", func() {
+		urlRepositoryMock.On("DeleteURLs", mock.Anything, userID, []string{"1"}).Return(nil, errors.New("connection reset")).Once()
+		urlRepositoryMock.On("DeleteURLs", mock.Anything, userID, []string{"1"}).Return([]string{"1"}, nil).Once()
+		id := deleteURLs(`["1"]`)
+		Eventually(func() interface{} { return taskStatus(id)["status"] }).Should(Equal("done"))
+		Expect(taskStatus(id)).To(HaveKeyWithValue("deleted", ConsistOf("1")))
+		urlRepositoryMock.AssertExpectations(GinkgoT())
+	})
+
+	It("should fail task after max attempts", func() {
+		urlRepositoryMock.On("DeleteURLs", mock.Anything, userID, []string{"1"}).Return(nil, errors.New("connection reset")).Twice()
+		id := deleteURLs(`["1"]`)
+		Eventually(func() interface{} { return taskStatus(id)["status"] }, 2*time.Second).Should(Equal("failed"))
+		urlRepositoryMock.AssertExpectations(GinkgoT())
+	})
+})
+
+// repositoryWithDeletionQueueMock хранилище ссылок с хранимой очередью запросов на удаление
+type repositoryWithDeletionQueueMock struct {
+	*mocks.URLRepository
+	*mocks.DeletionQueueRepository
+}
+
+var _ = Describe("DeletionQueue", func() {
+	var ts *httptest.Server
+	var urlRepositoryMock *mocks.URLRepository
+	var deletionQueueMock *mocks.DeletionQueueRepository
+	var pending []repository.DeletionRequest
+
+	BeforeEach(func() {
+		urlRepositoryMock = new(mocks.URLRepository)
+		deletionQueueMock = new(mocks.DeletionQueueRepository)
+		pending = nil
+	})
+	JustBeforeEach(func() {
+		deletionQueueMock.On("PendingDeletions", mock.Anything).Return(pending, nil).Once()
+		cfg := config.Config{BaseURL: "http://localhost:8080", DeleteWorkers: 1, DeleteMaxAttempts: 1}
+		service := handlers.NewService(repositoryWithDeletionQueueMock{urlRepositoryMock, deletionQueueMock}, nil, cfg)
+		ts = httptest.NewServer(handlers.NewRouter(service))
+	})
+	AfterEach(func() {
+		ts.Close()
+	})
+
+	When("queue has pending requests", func() {
+		var completed chan struct{}
+		BeforeEach(func() {
+			pending = []repository.DeletionRequest{{ID: "task1", UserID: "user1", URLIDs: []string{"1", "2"}}}
+			urlRepositoryMock.On("DeleteURLs", mock.Anything, "user1", []string{"1", "2"}).Return([]string{"1"}, nil).Once()
+			completed = make(chan struct{})
+			deletionQueueMock.On("CompleteDeletions", mock.Anything, []string{"task1"}).Return(nil).Once().Run(func(mock.Arguments) { close(completed) })
+		})
+
+		It("should delete urls on start and remove requests from queue", func() {
+			Eventually(completed).Should(BeClosed())
+			urlRepositoryMock.AssertExpectations(GinkgoT())
+		})
+	})
+
+	When("url deletion is requested", func() {
+		var userID string
+		var cookie *http.Cookie
+		JustBeforeEach(func() {
+			urlRepositoryMock.On("LoadByUserID", mock.Anything, mock.Anything).Return([]repository.URLEntity{}, nil).Once()
+			res := testGetList(ts, nil)
+			cookie = res.Cookies()[0]
+			userID = strings.Split(cookie.Value, ":")[0]
+		})
+
+		It("should store request in queue before responding", func() {
+			var taskID string
+			deletionQueueMock.On("EnqueueDeletion", mock.Anything, mock.MatchedBy(func(req repository.DeletionRequest) bool {
+				taskID = req.ID
+				return req.UserID == userID && len(req.URLIDs) == 1 && req.URLIDs[0] == "123"
+			})).Return(nil).Once()
+			urlRepositoryMock.On("DeleteURLs", mock.Anything, mock.Anything, []string{"123"}).Return([]string{"123"}, nil).Once()
+			completed := make(chan struct{})
+			deletionQueueMock.On("CompleteDeletions", mock.Anything, mock.Anything).Return(nil).Once().Run(func(mock.Arguments) { close(completed) })
+
+			res := testRequest(ts, "DELETE", "/api/user/urls", []*http.Cookie{cookie}, strings.NewReader(`["123"]`))
+			defer res.Body.Close()
+			Expect(res.StatusCode).To(Equal(http.StatusAccepted))
+			Expect(res.Header.Get("Location")).To(HaveSuffix(taskID))
+			Eventually(completed).Should(BeClosed())
+			deletionQueueMock.AssertExpectations(GinkgoT())
+		})
+
+		It("should keep request in queue when deletion fails", func() {
+			deletionQueueMock.On("EnqueueDeletion", mock.Anything, mock.Anything).Return(nil).Once()
+			urlRepositoryMock.On("DeleteURLs", mock.Anything, mock.Anything, []string{"123"}).Return(nil, errors.New("db is down"))
+
+			res := testRequest(ts, "DELETE", "/api/user/urls", []*http.Cookie{cookie}, strings.NewReader(`["123"]`))
+			defer res.Body.Close()
+			Expect(res.StatusCode).To(Equal(http.StatusAccepted))
+			var status map[string]interface{}
+			Expect(json.NewDecoder(res.Body).Decode(&status)).To(Succeed())
+
+			taskStatus := func() map[string]interface{} {
+				res := testRequest(ts, "GET", "/api/user/urls/deletions/"+status["id"].(string), []*http.Cookie{cookie}, nil)
+				defer res.Body.Close()
+				var status map[string]interface{}
+				Expect(json.NewDecoder(res.Body).Decode(&status)).To(Succeed())
+				return status
+			}
+			Eventually(func() interface{} { return taskStatus()["status"] }).Should(Equal("failed"))
+			Expect(taskStatus()).To(HaveKeyWithValue("error", ContainSubstring("retried after restart")))
+			deletionQueueMock.AssertNotCalled(GinkgoT(), "CompleteDeletions", mock.Anything, mock.Anything)
+		})
+
+		It("should respond 500 when request could not be stored", func() {
+			deletionQueueMock.On("EnqueueDeletion", mock.Anything, mock.Anything).Return(errors.New("db is down")).Once()
+			res := testRequest(ts, "DELETE", "/api/user/urls", []*http.Cookie{cookie}, strings.NewReader(`["123"]`))
+			defer res.Body.Close()
+			Expect(res.StatusCode).To(Equal(http.StatusInternalServerError))
+			urlRepositoryMock.AssertNotCalled(GinkgoT(), "DeleteURLs", mock.Anything, mock.Anything, mock.Anything)
+		})
+	})
+})
+
+var _ = Describe("Shutdown", func() {
+	var ts *httptest.Server
+	var service *handlers.Service
+	var urlRepositoryMock *mocks.URLRepository
+	var cookie *http.Cookie
+	var userID string
+
+	BeforeEach(func() {
+		urlRepositoryMock = new(mocks.URLRepository)
+		cfg := config.Config{
+			BaseURL:             "http://localhost:8080",
+			DeleteBatchSize:     100,
+			DeleteFlushInterval: time.Hour,
+			DeleteWorkers:       1,
+			DeleteMaxAttempts:   1,
+		}
+
+		service = handlers.NewService(urlRepositoryMock, nil, cfg)
+		ts = httptest.NewServer(handlers.NewRouter(service))
+
+		urlRepositoryMock.On("LoadByUserID", mock.Anything, mock.Anything).Return([]repository.URLEntity{}, nil).Once()
+		res := testGetList(ts, nil)
+		cookie = res.Cookies()[0]
+		userID = strings.Split(cookie.Value, ":")[0]
+	})
+	AfterEach(func() {
+		ts.Close()
+	})
+
+	It("should delete pending urls before stopping", func() {
+		urlRepositoryMock.On("DeleteURLs", mock.Anything, userID, []string{"1", "2"}).Return([]string{"1", "2"}, nil).Once()
+		res := testRequest(ts, "DELETE", "/api/user/urls", []*http.Cookie{cookie}, strings.NewReader(`["1", "2"]`))
+		res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusAccepted))
+		urlRepositoryMock.AssertNotCalled(GinkgoT(), "DeleteURLs", mock.Anything, mock.Anything, mock.Anything)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		Expect(service.Shutdown(ctx)).To(Succeed())
+		urlRepositoryMock.AssertExpectations(GinkgoT())
+	})
+})
@@ -0,0 +1,315 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"sync"
+	"time"
+)
+
+// deleteURLsMetrics метрики удаления ссылок, публикуются через expvar (см. /api/admin/metrics):
+// queued_requests, queued_urls - запросы и ссылки, ожидающие удаления; flushes - вызовы DeleteURLs;
+// retries - повторные вызовы после ошибки; failures - пакеты, которые не удалось удалить; deleted - удаленные ссылки
+var deleteURLsMetrics = expvar.NewMap("delete_urls")
+
+// deleteRetryBackoff пауза перед первым повтором удаления, дальше удваивается
+const deleteRetryBackoff = 100 * time.Millisecond
+
+// deleteURLsInbox запросы на удаление, еще не принятые конвейером. Очередь не ограничена и не блокирует DeleteURLsHandler:
+// если хранилище поддерживает очередь удаления, запросы в ней уже сохранены, иначе - занимают память до обработки
+type deleteURLsInbox struct {
+	mx    sync.Mutex
+	tasks []*deletionTask
+	// notify сигнализирует конвейеру о новых запросах
+	notify chan struct{}
+}
+
+func newDeleteURLsInbox() *deleteURLsInbox {
+	return &deleteURLsInbox{notify: make(chan struct{}, 1)}
+}
+
+func (i *deleteURLsInbox) push(task *deletionTask) {
+	i.mx.Lock()
+	i.tasks = append(i.tasks, task)
+	i.mx.Unlock()
+	deleteURLsMetrics.Add("queued_requests", 1)
+	deleteURLsMetrics.Add("queued_urls", int64(len(task.ids)))
+	select {
+	case i.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (i *deleteURLsInbox) takeAll() []*deletionTask {
+	i.mx.Lock()
+	defer i.mx.Unlock()
+	tasks := i.tasks
+	i.tasks = nil
+	return tasks
+}
+
+// deleteURLsBatch запросы на удаление одного пользователя, объединенные в один вызов DeleteURLs
+type deleteURLsBatch struct {
+	userID string
+	ids    []string
+	seen   map[string]struct{}
+	tasks  []*deletionTask
+}
+
+func newDeleteURLsBatch(userID string) *deleteURLsBatch {
+	return &deleteURLsBatch{userID: userID, seen: make(map[string]struct{})}
+}
+
+func (b *deleteURLsBatch) add(task *deletionTask) {
+	b.tasks = append(b.tasks, task)
+	for _, id := range task.ids {
+		if _, ok := b.seen[id]; !ok {
+			b.seen[id] = struct{}{}
+			b.ids = append(b.ids, id)
+		}
+	}
+}
+
+// activeIDs возвращает ссылки пакета без восстановленных после запроса на удаление (см. deletionTask.cancel).
+// Ссылка удаляется, если ее не восстановили хотя бы в одной задаче пакета
+func (b *deleteURLsBatch) activeIDs() []string {
+	active := make(map[string]struct{}, len(b.ids))
+	for _, task := range b.tasks {
+		for _, id := range task.ids {
+			if !task.isCancelled(id) {
+				active[id] = struct{}{}
+			}
+		}
+	}
+	ids := make([]string, 0, len(active))
+	for _, id := range b.ids {
+		if _, ok := active[id]; ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// startDeleteURLsWorkers запускает конвейер удаления ссылок. Запросы накапливаются по пользователям и передаются
+// workers обработчикам одним вызовом DeleteURLs, когда у пользователя набирается DeleteBatchSize ссылок или раз в DeleteFlushInterval.
+// Пока все обработчики заняты, запросы продолжают объединяться.
+// При отмене ctx накопленные запросы удаляются (одной попыткой) и конвейер останавливается, после чего закрывается s.deleteURLsDone.
+// Запросы, которые не удалось выполнить, остаются в очереди хранилища и выполняются после перезапуска
+func (s *Service) startDeleteURLsWorkers(ctx context.Context, workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	batchCh := make(chan *deleteURLsBatch)
+	go s.coalesceDeleteURLsRequests(ctx, batchCh, workers)
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		workerID := fmt.Sprintf("DeleteURLsWorker#%d", i+1)
+		go func() {
+			defer wg.Done()
+			log.Info().Str("worker", workerID).Msg("starting delete urls worker")
+			for batch := range batchCh {
+				s.processDeleteURLsBatch(ctx, workerID, batch)
+			}
+			log.Info().Str("worker", workerID).Msg("stopping delete urls worker")
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(s.deleteURLsDone)
+	}()
+}
+
+// replayDeletions ставит в конвейер невыполненные запросы на удаление из очереди хранилища
+func (s *Service) replayDeletions(ctx context.Context) {
+	pending, err := s.DeletionQueue.PendingDeletions(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("could not load pending url deletions")
+		return
+	}
+	for _, req := range pending {
+		task := &deletionTask{
+			id:     req.ID,
+			userID: req.UserID,
+			ids:    req.URLIDs,
+			status: deletionTaskPending,
+		}
+		s.deletionTasks.add(task)
+		s.deleteURLsInbox.push(task)
+	}
+	if len(pending) > 0 {
+		log.Info().Int("count", len(pending)).Msg("pending url deletions restored")
+	}
+}
+
+func (s *Service) coalesceDeleteURLsRequests(ctx context.Context, batchCh chan<- *deleteURLsBatch, maxReady int) {
+	defer close(batchCh)
+	flushInterval := s.Config().DeleteFlushInterval
+	if flushInterval <= 0 {
+		flushInterval = time.Millisecond
+	}
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	pending := make(map[string]*deleteURLsBatch)
+	var ready []*deleteURLsBatch
+	flush := func(userID string) {
+		ready = append(ready, pending[userID])
+		delete(pending, userID)
+	}
+	accept := func(tasks []*deletionTask) {
+		batchSize := s.Config().DeleteBatchSize
+		for _, task := range tasks {
+			batch, ok := pending[task.userID]
+			if !ok {
+				batch = newDeleteURLsBatch(task.userID)
+				pending[task.userID] = batch
+			}
+			batch.add(task)
+			if len(batch.ids) >= batchSize {
+				flush(batch.userID)
+			}
+		}
+	}
+	for {
+		// nil-каналы выключают соответствующие ветки select
+		var in <-chan struct{}
+		if len(ready) < maxReady {
+			in = s.deleteURLsInbox.notify
+		}
+		var out chan<- *deleteURLsBatch
+		var next *deleteURLsBatch
+		if len(ready) > 0 {
+			out, next = batchCh, ready[0]
+		}
+
+		select {
+		case <-ctx.Done():
+			accept(s.deleteURLsInbox.takeAll())
+			for userID := range pending {
+				flush(userID)
+			}
+			log.Info().Int("batches", len(ready)).Msg("draining delete urls queue")
+			for _, batch := range ready {
+				batchCh <- batch
+			}
+			return
+		case <-in:
+			accept(s.deleteURLsInbox.takeAll())
+		case out <- next:
+			ready = ready[1:]
+		case <-ticker.C:
+			for userID := range pending {
+				flush(userID)
+			}
+		}
+	}
+}
+
+func (s *Service) processDeleteURLsBatch(ctx context.Context, workerID string, batch *deleteURLsBatch) {
+	deleted, err := s.deleteURLsWithRetries(ctx, workerID, batch)
+	// из очереди убираются только выполненные запросы. Невыполненные (после всех попыток или из-за остановки сервиса)
+	// остаются в ней и выполняются после перезапуска
+	if s.DeletionQueue != nil && err == nil {
+		taskIDs := make([]string, len(batch.tasks))
+		for idx, task := range batch.tasks {
+			taskIDs[idx] = task.id
+		}
+		completeCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if completeErr := s.DeletionQueue.CompleteDeletions(completeCtx, taskIDs); completeErr != nil {
+			log.Error().Err(completeErr).Str("worker", workerID).Strs("tasks", taskIDs).Msg("could not remove completed url deletions from queue")
+		}
+		cancel()
+	}
+
+	deletedSet := make(map[string]struct{}, len(deleted))
+	for _, id := range deleted {
+		deletedSet[id] = struct{}{}
+	}
+	taskErr := err
+	if err != nil && s.DeletionQueue != nil {
+		taskErr = fmt.Errorf("%w; deletion will be retried after restart", err)
+	}
+	queuedURLs := 0
+	for _, task := range batch.tasks {
+		queuedURLs += len(task.ids)
+		s.finishDeletionTask(task, deletedOf(task, deletedSet), taskErr)
+	}
+	deleteURLsMetrics.Add("queued_requests", -int64(len(batch.tasks)))
+	deleteURLsMetrics.Add("queued_urls", -int64(queuedURLs))
+
+	if err != nil {
+		deleteURLsMetrics.Add("failures", 1)
+		log.Error().
+			Err(err).
+			Str("worker", workerID).
+			Strs("ids", batch.ids).
+			Str("userID", batch.userID).
+			Msg("error while deleting user urls")
+		return
+	}
+	deleteURLsMetrics.Add("deleted", int64(len(deleted)))
+	log.Info().
+		Str("worker", workerID).
+		Int("requests", len(batch.tasks)).
+		Strs("ids", deleted).
+		Str("userID", batch.userID).
+		Msg("urls deleted")
+}
+
+// deleteURLsWithRetries вызывает DeleteURLs до DeleteMaxAttempts раз. Хранилище не отличает временные ошибки от постоянных,
+// поэтому повторяется любая ошибка, кроме остановки сервиса. Удаление идемпотентно, повтор частично выполненного удаления безопасен.
+// Запрос к хранилищу не зависит от ctx, чтобы при остановке сервиса накопленные запросы успели выполниться
+func (s *Service) deleteURLsWithRetries(ctx context.Context, workerID string, batch *deleteURLsBatch) ([]string, error) {
+	backoff := deleteRetryBackoff
+	for attempt := 1; ; attempt++ {
+		deleted, err := s.deleteActiveURLs(batch)
+		if err == nil || attempt >= s.Config().DeleteMaxAttempts || ctx.Err() != nil {
+			return deleted, err
+		}
+
+		deleteURLsMetrics.Add("retries", 1)
+		log.Warn().Err(err).Str("worker", workerID).Int("attempt", attempt).Str("userID", batch.userID).Msg("retrying delete user urls")
+		select {
+		case <-ctx.Done():
+			return nil, errors.New("service is stopping")
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// deleteActiveURLs удаляет ссылки пакета, кроме восстановленных. Восстановление ждет завершения начатого удаления (см. cancelPendingDeletions),
+// поэтому восстановленная ссылка не может быть удалена запросом, поступившим до восстановления
+func (s *Service) deleteActiveURLs(batch *deleteURLsBatch) ([]string, error) {
+	s.deletionsMx.RLock()
+	defer s.deletionsMx.RUnlock()
+	ids := batch.activeIDs()
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	deleteURLsMetrics.Add("flushes", 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.Repository.DeleteURLs(ctx, batch.userID, ids)
+}
+
+// deletedOf возвращает ссылки задачи, попавшие в deleted
+func deletedOf(task *deletionTask, deleted map[string]struct{}) []string {
+	result := make([]string, 0, len(task.ids))
+	seen := make(map[string]struct{}, len(task.ids))
+	for _, id := range task.ids {
+		if _, ok := deleted[id]; !ok {
+			continue
+		}
+		if _, ok := seen[id]; !ok {
+			seen[id] = struct{}{}
+			result = append(result, id)
+		}
+	}
+	return result
+}
@@ -1,11 +1,13 @@
 package handlers
 
 import (
+	"context"
 	"errors"
 	"github.com/go-chi/chi/v5"
 	"github.com/rs/zerolog/log"
 	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/repository"
 	"net/http"
+	"time"
 )
 
 // ExpandURLHandler обрабатывает запросы на сокращение ссылок
@@ -24,14 +26,68 @@ func (s *Service) ExpandURLHandler() http.HandlerFunc {
 			return
 		}
 
-		if u.Deleted {
+		if u.Deleted || u.IsExpired(time.Now()) {
 			w.WriteHeader(http.StatusGone)
 			return
 		}
 
+		s.recordClick(r, urlID)
+
 		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 		w.Header().Set("Location", u.OriginalURL)
 		w.WriteHeader(http.StatusTemporaryRedirect)
 
 	}
 }
+
+// clicksQueueSize сколько переходов может ждать записи в хранилище. Переходы сверх этого не учитываются
+const clicksQueueSize = 1024
+
+// recordClick ставит переход по ссылке в очередь на запись в хранилище, чтобы запись не задерживала редирект.
+// Если очередь заполнена - переход не учитывается: статистика не должна мешать редиректу
+func (s *Service) recordClick(r *http.Request, urlID string) {
+	if s.ClickRepository == nil {
+		return
+	}
+	click := repository.Click{
+		URLID:     urlID,
+		ClickedAt: time.Now().UTC(),
+		Referrer:  r.Referer(),
+		UserAgent: r.UserAgent(),
+	}
+	select {
+	case s.clicks <- click:
+	default:
+		log.Warn().Str("urlID", urlID).Msg("clicks queue is full, click dropped")
+	}
+}
+
+// startClicksRecorder записывает переходы из очереди в хранилище. При остановке сервиса записывает оставшиеся в очереди переходы
+func (s *Service) startClicksRecorder(ctx context.Context) {
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		for {
+			select {
+			case click := <-s.clicks:
+				s.storeClick(click)
+			case <-ctx.Done():
+				for {
+					select {
+					case click := <-s.clicks:
+						s.storeClick(click)
+					default:
+						return
+					}
+				}
+			}
+		}
+	}()
+}
+
+// storeClick ошибка записи перехода только логируется. Контекст не связан с запросом, так как запрос к этому моменту уже завершен
+func (s *Service) storeClick(click repository.Click) {
+	if err := s.ClickRepository.RecordClick(context.Background(), click); err != nil {
+		log.Error().Err(err).Str("urlID", click.URLID).Msg("error while recording click")
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func Test_ExpandURLHandler(t *testing.T) {
@@ -47,6 +48,40 @@ func Test_ExpandURLHandler(t *testing.T) {
 				locationHeader: "http://google.com",
 			},
 		},
+		{
+			name: "should respond 410 on expired url",
+			request: request{
+				url:    "/shortExpired",
+				method: http.MethodGet,
+			},
+			storage: func() *repositoryMocks.URLRepository {
+				expiresAt := time.Now().Add(-time.Minute)
+				urlStorage := new(repositoryMocks.URLRepository)
+				urlStorage.On("Load", mock.Anything, "shortExpired").Return(repository.URLEntity{OriginalURL: "http://google.com", ExpiresAt: &expiresAt}, nil).Once()
+				return urlStorage
+			}(),
+			want: want{
+				statusCode: http.StatusGone,
+			},
+		},
+		{
+			name: "should expand url which is not expired yet",
+			request: request{
+				url:    "/shortNotExpired",
+				method: http.MethodGet,
+			},
+			storage: func() *repositoryMocks.URLRepository {
+				expiresAt := time.Now().Add(time.Hour)
+				urlStorage := new(repositoryMocks.URLRepository)
+				urlStorage.On("Load", mock.Anything, "shortNotExpired").Return(repository.URLEntity{OriginalURL: "http://google.com", ExpiresAt: &expiresAt}, nil).Once()
+				return urlStorage
+			}(),
+			want: want{
+				contentType:    "text/plain; charset=utf-8",
+				statusCode:     http.StatusTemporaryRedirect,
+				locationHeader: "http://google.com",
+			},
+		},
 		{
 			name: "should fail on empty req",
 			request: request{
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	errAmbiguousExpiration = errors.New("only one of expires_at and ttl can be specified")
+	errInvalidTTL          = errors.New("ttl must be positive")
+	errExpirationInPast    = errors.New("expires_at must be in the future")
+)
+
+// resolveExpiration вычисляет момент истечения срока действия ссылки по полям запроса expires_at или ttl (в секундах).
+// Возвращает nil, если срок действия не задан
+func resolveExpiration(expiresAt *time.Time, ttl int64, now time.Time) (*time.Time, error) {
+	if expiresAt != nil && ttl != 0 {
+		return nil, errAmbiguousExpiration
+	}
+	if ttl < 0 {
+		return nil, errInvalidTTL
+	}
+	if ttl > 0 {
+		result := now.Add(time.Duration(ttl) * time.Second).UTC()
+		return &result, nil
+	}
+	if expiresAt != nil {
+		if !expiresAt.After(now) {
+			return nil, errExpirationInPast
+		}
+		result := expiresAt.UTC()
+		return &result, nil
+	}
+	return nil, nil
+}
@@ -11,10 +11,14 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"time"
 )
 
 type jsonShortenRequest struct {
-	URL string `json:"url"`
+	URL       string     `json:"url"`
+	Alias     string     `json:"alias,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	TTL       int64      `json:"ttl,omitempty"`
 }
 
 type jsonShortenResponse struct {
@@ -51,6 +55,21 @@ func (s *Service) JSONShortenURLHandler() http.HandlerFunc {
 			return
 		}
 
+		if req.Alias != "" {
+			if err = validateAlias(req.Alias); err != nil {
+				log.Info().Err(err).Str("alias", req.Alias).Msg("invalid alias")
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		expiresAt, err := resolveExpiration(req.ExpiresAt, req.TTL, time.Now())
+		if err != nil {
+			log.Info().Err(err).Msg("invalid expiration")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		userID, err := cookieauth.FromContext(r.Context())
 		if err != nil {
 			log.Info().Err(err).Msg("unauthorized")
@@ -58,15 +77,27 @@ func (s *Service) JSONShortenURLHandler() http.HandlerFunc {
 			return
 		}
 
-		id := s.IDGenerator.GenerateURLID(u.String())
 		urlEntity := repository.URLEntity{
-			ID:          id,
-			OriginalURL: u.String(),
+			ID:          req.Alias,
+			OriginalURL: s.normalizeURL(u.String()),
 			UserID:      userID,
+			ExpiresAt:   expiresAt,
 		}
 		status := http.StatusCreated
-		err = s.Repository.Store(r.Context(), urlEntity)
+		var id string
+		if req.Alias != "" {
+			id = req.Alias
+			err = s.Repository.Store(r.Context(), urlEntity)
+		} else {
+			id, err = s.storeWithGeneratedID(r.Context(), urlEntity)
+		}
 		if err != nil {
+			var errIDConflict *repository.ErrURLIDConflict
+			if req.Alias != "" && errors.As(err, &errIDConflict) {
+				log.Info().Err(err).Str("alias", req.Alias).Msg("alias is already taken")
+				http.Error(w, "Alias is already taken", http.StatusConflict)
+				return
+			}
 			var errExists *repository.ErrURLExists
 			if !errors.As(err, &errExists) {
 				log.Error().Err(err).Msg("could not write url to repository")
@@ -77,7 +108,7 @@ func (s *Service) JSONShortenURLHandler() http.HandlerFunc {
 			status = http.StatusConflict
 		}
 
-		resp := &jsonShortenResponse{Result: fmt.Sprintf("%s/%s", s.Config.BaseURL, id)}
+		resp := &jsonShortenResponse{Result: fmt.Sprintf("%s/%s", s.Config().BaseURL, id)}
 		respJSON, err := json.Marshal(resp)
 		if err != nil {
 			log.Error().Err(err).Msg("error while serializing response")
@@ -6,6 +6,7 @@ import (
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/config"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/repository"
 	repositoryMocks "github.com/thorgnir-go-study/go-musthave-shortener/internal/app/repository/mocks"
 	shortenerMocks "github.com/thorgnir-go-study/go-musthave-shortener/internal/app/shortener/mocks"
 	"io"
@@ -13,6 +14,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 func Test_JSONShortenURLHandler(t *testing.T) {
@@ -53,10 +55,115 @@ func Test_JSONShortenURLHandler(t *testing.T) {
 			}(),
 			idGenerator: func() *shortenerMocks.URLIDGenerator {
 				gen := new(shortenerMocks.URLIDGenerator)
-				gen.On("GenerateURLID", "http://google.com").Return("shortGoogle").Once()
+				gen.On("GenerateURLID", mock.Anything, "http://google.com", mock.Anything).Return("shortGoogle", nil).Once()
 				return gen
 			}(),
 		},
+		{
+			name: "should shorten with ttl",
+			request: request{
+				url:    "/api/shorten",
+				method: http.MethodPost,
+				body:   `{"url": "http://google.com", "ttl": 3600}`,
+			},
+			want: want{
+				contentType: "application/json; charset=utf-8",
+				statusCode:  http.StatusCreated,
+				body:        `{"result":"http://localhost:8080/shortGoogle"}`,
+			},
+			storage: func() *repositoryMocks.URLRepository {
+				urlStorage := new(repositoryMocks.URLRepository)
+				urlStorage.On("Store", mock.Anything, mock.MatchedBy(func(e repository.URLEntity) bool {
+					return e.ExpiresAt != nil && e.ExpiresAt.After(time.Now().Add(59*time.Minute))
+				})).Return(nil).Once()
+				return urlStorage
+			}(),
+			idGenerator: func() *shortenerMocks.URLIDGenerator {
+				gen := new(shortenerMocks.URLIDGenerator)
+				gen.On("GenerateURLID", mock.Anything, "http://google.com", mock.Anything).Return("shortGoogle", nil).Once()
+				return gen
+			}(),
+		},
+		{
+			name: "should fail on negative ttl",
+			request: request{
+				url:    "/api/shorten",
+				method: http.MethodPost,
+				body:   `{"url": "http://google.com", "ttl": -1}`,
+			},
+			want: want{
+				statusCode: http.StatusBadRequest,
+			},
+		},
+		{
+			name: "should fail on expires_at in the past",
+			request: request{
+				url:    "/api/shorten",
+				method: http.MethodPost,
+				body:   `{"url": "http://google.com", "expires_at": "2000-01-01T00:00:00Z"}`,
+			},
+			want: want{
+				statusCode: http.StatusBadRequest,
+			},
+		},
+		{
+			name: "should shorten with alias",
+			request: request{
+				url:    "/api/shorten",
+				method: http.MethodPost,
+				body:   `{"url": "http://google.com", "alias": "spring-sale"}`,
+			},
+			want: want{
+				contentType: "application/json; charset=utf-8",
+				statusCode:  http.StatusCreated,
+				body:        `{"result":"http://localhost:8080/spring-sale"}`,
+			},
+			storage: func() *repositoryMocks.URLRepository {
+				urlStorage := new(repositoryMocks.URLRepository)
+				urlStorage.On("Store", mock.Anything, mock.MatchedBy(func(e repository.URLEntity) bool {
+					return e.ID == "spring-sale"
+				})).Return(nil).Once()
+				return urlStorage
+			}(),
+		},
+		{
+			name: "should respond 409 when alias is taken",
+			request: request{
+				url:    "/api/shorten",
+				method: http.MethodPost,
+				body:   `{"url": "http://google.com", "alias": "spring-sale"}`,
+			},
+			want: want{
+				statusCode: http.StatusConflict,
+			},
+			storage: func() *repositoryMocks.URLRepository {
+				urlStorage := new(repositoryMocks.URLRepository)
+				urlStorage.On("Store", mock.Anything, mock.Anything).Return(repository.NewErrURLIDConflict("spring-sale")).Once()
+				return urlStorage
+			}(),
+		},
+		{
+			name: "should fail on alias with invalid characters",
+			request: request{
+				url:    "/api/shorten",
+				method: http.MethodPost,
+				body:   `{"url": "http://google.com", "alias": "spring sale!"}`,
+			},
+			want: want{
+				statusCode: http.StatusBadRequest,
+			},
+		},
+		{
+			name: "should fail on reserved alias",
+			request: request{
+				url:    "/api/shorten",
+				method: http.MethodPost,
+				body:   `{"url": "http://google.com", "alias": "ping"}`,
+			},
+			want: want{
+				statusCode: http.StatusBadRequest,
+			},
+		},
 		{
 			name: "should fail on empty body",
 			request: request{
@@ -107,7 +214,7 @@ func Test_JSONShortenURLHandler(t *testing.T) {
 			}(),
 			idGenerator: func() *shortenerMocks.URLIDGenerator {
 				gen := new(shortenerMocks.URLIDGenerator)
-				gen.On("GenerateURLID", "http://google.com").Return("shortGoogle").Once()
+				gen.On("GenerateURLID", mock.Anything, "http://google.com", mock.Anything).Return("shortGoogle", nil).Once()
 				return gen
 			}(),
 		},
@@ -2,17 +2,36 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/rs/zerolog/log"
 	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/middlewares/cookieauth"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/repository"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 type responseEntity struct {
 	ShortURL    string `json:"short_url"`
 	OriginalURL string `json:"original_url"`
+	// время не выводится для ссылок, сохраненных до того, как хранилище начало его записывать
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
+const (
+	defaultURLsPageLimit = 100
+	maxURLsPageLimit     = 1000
+)
+
+// nextCursorHeader заголовок ответа с курсором следующей страницы. Отсутствует на последней странице
+const nextCursorHeader = "X-Next-Cursor"
+
+// LoadByUserHandler возвращает ссылки пользователя.
+// Если передан хотя бы один из параметров limit, cursor, order (asc - в порядке создания, desc - от новых к старым), q (подстрока оригинальной ссылки) -
+// возвращается страница ссылок, курсор следующей страницы - в заголовке X-Next-Cursor. Без параметров возвращаются все ссылки
 func (s *Service) LoadByUserHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID, err := cookieauth.FromContext(r.Context())
@@ -22,22 +41,50 @@ func (s *Service) LoadByUserHandler() http.HandlerFunc {
 			return
 		}
 
-		urlEntities, err := s.Repository.LoadByUserID(r.Context(), userID)
-		if err != nil {
-			log.Error().Err(err).Msg("error while getting links from repository")
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+		var urlEntities []repository.URLEntity
+		if isPageRequest(r) {
+			query, err := parseURLPageQuery(r, userID)
+			if err != nil {
+				log.Info().Err(err).Msg("invalid page query")
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			page, err := s.Repository.LoadPageByUserID(r.Context(), query)
+			if errors.Is(err, repository.ErrInvalidCursor) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				log.Error().Err(err).Msg("error while getting links from repository")
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if page.NextCursor != "" {
+				w.Header().Set(nextCursorHeader, page.NextCursor)
+			}
+			urlEntities = page.Entities
+		} else {
+			urlEntities, err = s.Repository.LoadByUserID(r.Context(), userID)
+			if err != nil {
+				log.Error().Err(err).Msg("error while getting links from repository")
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
 		}
 		if len(urlEntities) == 0 {
 			w.WriteHeader(http.StatusNoContent)
 			return
 		}
 
+		baseURL := s.Config().BaseURL
 		respEntities := make([]responseEntity, len(urlEntities))
 		for idx := range urlEntities {
 			respEntities[idx] = responseEntity{
-				ShortURL:    fmt.Sprintf("%s/%s", s.Config.BaseURL, urlEntities[idx].ID),
+				ShortURL:    fmt.Sprintf("%s/%s", baseURL, urlEntities[idx].ID),
 				OriginalURL: urlEntities[idx].OriginalURL,
+				CreatedAt:   optionalTime(urlEntities[idx].CreatedAt),
+				UpdatedAt:   optionalTime(urlEntities[idx].UpdatedAt),
+				DeletedAt:   urlEntities[idx].DeletedAt,
 			}
 		}
 
@@ -55,3 +102,44 @@ func (s *Service) LoadByUserHandler() http.HandlerFunc {
 
 	}
 }
+
+func isPageRequest(r *http.Request) bool {
+	query := r.URL.Query()
+	for _, param := range []string{"limit", "cursor", "order", "q"} {
+		if _, ok := query[param]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func parseURLPageQuery(r *http.Request, userID string) (repository.URLPageQuery, error) {
+	params := r.URL.Query()
+	query := repository.URLPageQuery{
+		UserID:              userID,
+		Limit:               defaultURLsPageLimit,
+		Cursor:              params.Get("cursor"),
+		OriginalURLContains: params.Get("q"),
+	}
+	if limit := params.Get("limit"); limit != "" {
+		var err error
+		if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit < 1 || query.Limit > maxURLsPageLimit {
+			return repository.URLPageQuery{}, fmt.Errorf("limit must be between 1 and %d", maxURLsPageLimit)
+		}
+	}
+	switch params.Get("order") {
+	case "", "asc":
+	case "desc":
+		query.Descending = true
+	default:
+		return repository.URLPageQuery{}, errors.New("order must be asc or desc")
+	}
+	return query, nil
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
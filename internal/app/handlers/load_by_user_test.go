@@ -12,6 +12,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"time"
 )
 
 var _ = Describe("LoadByUser", func() {
@@ -86,6 +87,9 @@ var _ = Describe("LoadByUser", func() {
 					ID:          "456",
 					OriginalURL: "http://yandex.ru",
 					UserID:      userID,
+					CreatedAt:   time.Date(2022, 1, 1, 10, 0, 0, 0, time.UTC),
+					UpdatedAt:   time.Date(2022, 1, 2, 10, 0, 0, 0, time.UTC),
+					DeletedAt:   func() *time.Time { t := time.Date(2022, 1, 2, 10, 0, 0, 0, time.UTC); return &t }(),
 				},
 			}
 			BeforeEach(func() {
@@ -100,7 +104,10 @@ var _ = Describe("LoadByUser", func() {
 }, 
 {
 "short_url": "http://localhost:8080/456", 
-"original_url": "http://yandex.ru"
+"original_url": "http://yandex.ru",
+"created_at": "2022-01-01T10:00:00Z",
+"updated_at": "2022-01-02T10:00:00Z",
+"deleted_at": "2022-01-02T10:00:00Z"
 }
 ]`
 				res := testGetList(ts, []*http.Cookie{cookie})
@@ -112,6 +119,49 @@ var _ = Describe("LoadByUser", func() {
 			})
 		})
 
+		When("page is requested", func() {
+			BeforeEach(func() {
+				repositoryMock.On("LoadPageByUserID", mock.Anything, repository.URLPageQuery{
+					UserID:              userID,
+					Limit:               1,
+					Cursor:              "abc",
+					Descending:          true,
+					OriginalURLContains: "google",
+				}).Return(repository.URLPage{
+					Entities:   []repository.URLEntity{{ID: "123", OriginalURL: "http://google.com", UserID: userID}},
+					NextCursor: "def",
+				}, nil).Once()
+			})
+
+			It("should return page and next cursor", func() {
+				res := testRequest(ts, "GET", "/api/user/urls?limit=1&cursor=abc&order=desc&q=google", []*http.Cookie{cookie}, nil)
+				Expect(res.StatusCode).To(Equal(200))
+				Expect(res.Header.Get("X-Next-Cursor")).To(Equal("def"))
+				body, err := io.ReadAll(res.Body)
+				defer res.Body.Close()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(body).To(MatchJSON(`[{"short_url": "http://localhost:8080/123", "original_url": "http://google.com"}]`))
+			})
+		})
+
+		When("cursor is invalid", func() {
+			BeforeEach(func() {
+				repositoryMock.On("LoadPageByUserID", mock.Anything, mock.Anything).Return(repository.URLPage{}, repository.ErrInvalidCursor).Once()
+			})
+
+			It("should respond 400", func() {
+				res := testRequest(ts, "GET", "/api/user/urls?cursor=!!!", []*http.Cookie{cookie}, nil)
+				defer res.Body.Close()
+				Expect(res.StatusCode).To(Equal(400))
+			})
+		})
+
+		It("should respond 400 on invalid limit", func() {
+			res := testRequest(ts, "GET", "/api/user/urls?limit=0", []*http.Cookie{cookie}, nil)
+			defer res.Body.Close()
+			Expect(res.StatusCode).To(Equal(400))
+			repositoryMock.AssertNotCalled(GinkgoT(), "LoadPageByUserID", mock.Anything, mock.Anything)
+		})
 	})
 })
 
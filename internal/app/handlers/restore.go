@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/rs/zerolog/log"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/middlewares/cookieauth"
+	"io"
+	"net/http"
+)
+
+// RestoreURLsHandler снимает пометку удаления со ссылок пользователя.
+// В отличие от удаления, восстановление выполняется сразу: после ответа ссылки снова доступны (если не истек срок их действия).
+// Запросы на удаление этих ссылок, поступившие до восстановления и еще не выполненные, отменяются
+func (s *Service) RestoreURLsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bodyContent, err := io.ReadAll(r.Body)
+		defer r.Body.Close()
+		if err != nil {
+			log.Error().Err(err).Msg("could not read request body")
+			http.Error(w, "Could not read request body", http.StatusInternalServerError)
+			return
+		}
+		var ids []string
+		if err = json.Unmarshal(bodyContent, &ids); err != nil {
+			log.Info().Err(err).Msg("invalid json")
+			http.Error(w, "Invalid json", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := cookieauth.FromContext(r.Context())
+		if err != nil {
+			log.Info().Err(err).Msg("unauthorized")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if err = s.cancelPendingDeletions(r.Context(), userID, ids); err != nil {
+			log.Error().Err(err).Strs("ids", ids).Str("userID", userID).Msg("error while cancelling pending url deletions")
+			http.Error(w, "Could not restore urls", http.StatusInternalServerError)
+			return
+		}
+		if err = s.Repository.RestoreURLs(r.Context(), userID, ids); err != nil {
+			log.Error().Err(err).Strs("ids", ids).Str("userID", userID).Msg("error while restoring user urls")
+			http.Error(w, "Could not restore urls", http.StatusInternalServerError)
+			return
+		}
+		log.Info().Strs("ids", ids).Str("userID", userID).Msg("urls restored")
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// cancelPendingDeletions исключает ссылки ids из невыполненных задач удаления пользователя и из хранимой очереди удаления,
+// чтобы ни конвейер, ни повтор очереди после перезапуска не удалили восстановленные ссылки.
+// Начатое удаление завершается до отмены: ссылки, удаленные им, восстанавливаются следом
+func (s *Service) cancelPendingDeletions(ctx context.Context, userID string, ids []string) error {
+	s.deletionsMx.Lock()
+	defer s.deletionsMx.Unlock()
+	for _, task := range s.deletionTasks.pendingOf(userID) {
+		task.cancel(ids)
+	}
+	if s.DeletionQueue == nil {
+		return nil
+	}
+	return s.DeletionQueue.CancelDeletions(ctx, userID, ids)
+}
@@ -0,0 +1,124 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/config"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/handlers"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/repository"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/repository/mocks"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+)
+
+var _ = Describe("RestoreURLs", func() {
+	var ts *httptest.Server
+	var urlRepositoryMock *mocks.URLRepository
+	var cookie *http.Cookie
+	var userID string
+
+	BeforeEach(func() {
+		urlRepositoryMock = new(mocks.URLRepository)
+		cfg := config.Config{BaseURL: "http://localhost:8080"}
+
+		service := handlers.NewService(urlRepositoryMock, nil, cfg)
+		r := handlers.NewRouter(service)
+		ts = httptest.NewServer(r)
+
+		urlRepositoryMock.On("LoadByUserID", mock.Anything, mock.Anything).Return([]repository.URLEntity{}, nil).Once()
+		res := testGetList(ts, nil)
+		cookie = res.Cookies()[0]
+		userID = strings.Split(cookie.Value, ":")[0]
+	})
+	AfterEach(func() {
+		ts.Close()
+	})
+
+	restore := func(body string) int {
+		res := testRequest(ts, "POST", "/api/user/urls/restore", []*http.Cookie{cookie}, strings.NewReader(body))
+		defer res.Body.Close()
+		return res.StatusCode
+	}
+
+	It("should restore user urls", func() {
+		urlRepositoryMock.On("RestoreURLs", mock.Anything, userID, []string{"123", "456"}).Return(nil).Once()
+		Expect(restore(`["123", "456"]`)).To(Equal(http.StatusNoContent))
+		urlRepositoryMock.AssertExpectations(GinkgoT())
+	})
+
+	It("should respond 400 on invalid json", func() {
+		Expect(restore(`{"id": "123"}`)).To(Equal(http.StatusBadRequest))
+		urlRepositoryMock.AssertNotCalled(GinkgoT(), "RestoreURLs", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	It("should respond 500 on repository error", func() {
+		urlRepositoryMock.On("RestoreURLs", mock.Anything, userID, []string{"123"}).Return(errors.New("db is down")).Once()
+		Expect(restore(`["123"]`)).To(Equal(http.StatusInternalServerError))
+	})
+})
+
+var _ = Describe("RestoreURLs with pending deletions", func() {
+	var ts *httptest.Server
+	var service *handlers.Service
+	var urlRepositoryMock *mocks.URLRepository
+	var deletionQueueMock *mocks.DeletionQueueRepository
+	var cookie *http.Cookie
+	var userID string
+
+	BeforeEach(func() {
+		urlRepositoryMock = new(mocks.URLRepository)
+		deletionQueueMock = new(mocks.DeletionQueueRepository)
+		deletionQueueMock.On("PendingDeletions", mock.Anything).Return(nil, nil).Once()
+		cfg := config.Config{
+			BaseURL:             "http://localhost:8080",
+			DeleteBatchSize:     100,
+			DeleteFlushInterval: time.Hour,
+			DeleteWorkers:       1,
+			DeleteMaxAttempts:   1,
+		}
+
+		service = handlers.NewService(repositoryWithDeletionQueueMock{urlRepositoryMock, deletionQueueMock}, nil, cfg)
+		ts = httptest.NewServer(handlers.NewRouter(service))
+
+		urlRepositoryMock.On("LoadByUserID", mock.Anything, mock.Anything).Return([]repository.URLEntity{}, nil).Once()
+		res := testGetList(ts, nil)
+		cookie = res.Cookies()[0]
+		userID = strings.Split(cookie.Value, ":")[0]
+	})
+	AfterEach(func() {
+		ts.Close()
+	})
+
+	It("should not delete urls restored after deletion request", func() {
+		deletionQueueMock.On("EnqueueDeletion", mock.Anything, mock.Anything).Return(nil).Once()
+		deletionQueueMock.On("CancelDeletions", mock.Anything, userID, []string{"1"}).Return(nil).Once()
+		urlRepositoryMock.On("RestoreURLs", mock.Anything, userID, []string{"1"}).Return(nil).Once()
+		urlRepositoryMock.On("DeleteURLs", mock.Anything, userID, []string{"2"}).Return([]string{"2"}, nil).Once()
+		deletionQueueMock.On("CompleteDeletions", mock.Anything, mock.Anything).Return(nil).Once()
+
+		res := testRequest(ts, "DELETE", "/api/user/urls", []*http.Cookie{cookie}, strings.NewReader(`["1", "2"]`))
+		res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusAccepted))
+		res = testRequest(ts, "POST", "/api/user/urls/restore", []*http.Cookie{cookie}, strings.NewReader(`["1"]`))
+		res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusNoContent))
+
+		// накопленные запросы на удаление выполняются при остановке
+		Expect(service.Shutdown(context.Background())).To(Succeed())
+		urlRepositoryMock.AssertExpectations(GinkgoT())
+		deletionQueueMock.AssertExpectations(GinkgoT())
+	})
+
+	It("should respond 500 and keep urls deleted when pending deletions could not be cancelled", func() {
+		deletionQueueMock.On("CancelDeletions", mock.Anything, userID, []string{"1"}).Return(errors.New("db is down")).Once()
+		res := testRequest(ts, "POST", "/api/user/urls/restore", []*http.Cookie{cookie}, strings.NewReader(`["1"]`))
+		res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusInternalServerError))
+		urlRepositoryMock.AssertNotCalled(GinkgoT(), "RestoreURLs", mock.Anything, mock.Anything, mock.Anything)
+	})
+})
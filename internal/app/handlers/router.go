@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"expvar"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/middlewares/cookieauth"
@@ -17,21 +18,42 @@ func NewRouter(service *Service) chi.Router {
 	r.Use(middleware.RealIP)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
-	r.Use(middleware.Timeout(10 * time.Second))
+	r.Use(request.FullDuplex(ndjsonContentType, csvContentType))
 	r.Use(middleware.Compress(5))
 	r.Use(request.GzipRequestDecompressor)
 
-	ca = cookieauth.New([]byte(service.Config.AuthSecretKey))
+	ca = cookieauth.New([]byte(service.Config().AuthSecretKey))
 	r.Use(cookieauth.Verifier(ca))
 	r.Use(cookieauth.Authenticator(ca))
 
-	r.Post("/", service.ShortenURLHandler())
-	r.Post("/api/shorten", service.JSONShortenURLHandler())
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.Timeout(10 * time.Second))
+
+		r.Post("/", service.ShortenURLHandler())
+		r.Post("/api/shorten", service.JSONShortenURLHandler())
+		r.Delete("/api/user/urls", service.DeleteURLsHandler())
+		r.Post("/api/user/urls/restore", service.RestoreURLsHandler())
+		r.Get("/api/user/urls/deletions/{taskID}", service.DeletionTaskStatusHandler())
+		r.Get("/{urlID}", service.ExpandURLHandler())
+		r.Get("/api/user/urls", service.LoadByUserHandler())
+		r.Patch("/api/user/urls/{urlID}", service.UpdateURLHandler())
+		r.Get("/api/user/urls/{urlID}/stats", service.URLStatsHandler())
+		r.Get("/ping", service.PingHandler())
+		r.Get("/api/shorten/jobs/{jobID}", service.ShortenJobStatusHandler())
+	})
+	// пакетное сокращение (в том числе потоковое), загрузка списка для фоновой задачи и выгрузка ее результата,
+	// импорт и экспорт ссылок, очистка хранилища могут идти дольше таймаута остальных запросов, таймауты обработки у них свои
 	r.Post("/api/shorten/batch", service.BatchShortenURLHandler())
-	r.Delete("/api/user/urls", service.DeleteURLsHandler())
-	r.Get("/{urlID}", service.ExpandURLHandler())
-	r.Get("/api/user/urls", service.LoadByUserHandler())
-	r.Get("/ping", service.PingHandler())
+	r.Post("/api/shorten/jobs", service.CreateShortenJobHandler())
+	r.Get("/api/shorten/jobs/{jobID}/result", service.ShortenJobResultHandler())
+	r.Post("/api/user/urls/import", service.ImportURLsCSVHandler())
+	r.Get("/api/user/urls/export", service.ExportURLsHandler())
+
+	r.Route("/api/admin", func(r chi.Router) {
+		r.Use(service.AdminAuthenticator)
+		r.Post("/urls/purge", service.PurgeDeletedURLsHandler())
+		r.Handle("/metrics", expvar.Handler())
+	})
 
 	return r
 }
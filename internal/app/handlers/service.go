@@ -2,69 +2,134 @@ package handlers
 
 import (
 	"context"
-	"fmt"
 	"github.com/rs/zerolog/log"
 	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/config"
 	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/repository"
 	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/shortener"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-type deleteURLsRequest struct {
-	ids    []string
-	userID string
-}
-
 type Service struct {
-	Repository      repository.URLRepository
+	Repository repository.URLRepository
+	// ClickRepository хранилище статистики переходов. nil, если хранилище ссылок не поддерживает сбор статистики
+	ClickRepository repository.ClickRepository
 	IDGenerator     shortener.URLIDGenerator
-	Config          config.Config
-	deleteURLsReqCh chan<- deleteURLsRequest
+	// config текущая конфигурация (config.Config), часть настроек может меняться на ходу (см. ApplyConfig)
+	config atomic.Value
+	// DeletionQueue хранимая очередь запросов на удаление. nil, если хранилище ссылок ее не поддерживает
+	DeletionQueue   repository.DeletionQueueRepository
+	deleteURLsInbox *deleteURLsInbox
+	// deleteURLsDone закрывается после остановки конвейера удаления ссылок
+	deleteURLsDone chan struct{}
+	shortenJobs    *shortenJobStore
+	deletionTasks  *deletionTaskStore
+
+	// clicks очередь переходов на запись в ClickRepository
+	clicks chan repository.Click
+	// deletionsMx упорядочивает удаление и восстановление ссылок: удаление выполняется под блокировкой на чтение,
+	// восстановление отменяет ожидающие удаления под блокировкой на запись
+	deletionsMx sync.RWMutex
+
+	// ctx контекст фоновых задач сервиса, отменяется при остановке сервиса
+	ctx  context.Context
+	stop context.CancelFunc
+	// background фоновые задачи, кроме конвейера удаления ссылок
+	background sync.WaitGroup
 }
 
-func NewService(repository repository.URLRepository, IDGenerator shortener.URLIDGenerator, config config.Config) *Service {
+func NewService(repo repository.URLRepository, IDGenerator shortener.URLIDGenerator, config config.Config) *Service {
 
-	s := &Service{Repository: repository, IDGenerator: IDGenerator, Config: config}
-	s.deleteURLsReqCh = s.startDeleteURLsWorkers(context.Background(), 5)
+	s := &Service{Repository: repo, IDGenerator: IDGenerator, shortenJobs: newShortenJobStore(), deletionTasks: newDeletionTaskStore()}
+	s.config.Store(config)
+	s.ctx, s.stop = context.WithCancel(context.Background())
+	if clickRepo, ok := repo.(repository.ClickRepository); ok {
+		s.ClickRepository = clickRepo
+		s.clicks = make(chan repository.Click, clicksQueueSize)
+		s.startClicksRecorder(s.ctx)
+	}
+	if deletionQueue, ok := repo.(repository.DeletionQueueRepository); ok {
+		s.DeletionQueue = deletionQueue
+	}
+	s.deleteURLsInbox = newDeleteURLsInbox()
+	s.deleteURLsDone = make(chan struct{})
+	if s.DeletionQueue != nil {
+		s.replayDeletions(s.ctx)
+	}
+	s.startDeleteURLsWorkers(s.ctx, config.DeleteWorkers)
+	if config.ExpiredURLsPurgeInterval > 0 {
+		s.startURLsSweeper(s.ctx, "expired", config.ExpiredURLsPurgeInterval, config.ExpiredURLsRetention, s.Repository.PurgeExpired)
+	}
+	if config.DeletedURLsPurgeInterval > 0 {
+		s.startURLsSweeper(s.ctx, "deleted", config.DeletedURLsPurgeInterval, config.DeletedURLsRetention, s.Repository.PurgeDeleted)
+	}
 
 	return s
 }
 
-func (s *Service) startDeleteURLsWorkers(ctx context.Context, count int) chan<- deleteURLsRequest {
-	ch := make(chan deleteURLsRequest, count*2)
-	for i := 0; i < count; i++ {
-		workerID := fmt.Sprintf("DeleteURLsWorker#%d", i+1)
-		go func() {
-			log.Info().Str("worker", workerID).Msg("starting delete urls worker")
-			for {
-				select {
-				case <-ctx.Done():
-					log.Info().Str("worker", workerID).Msg("stopping delete urls worker")
-				case req := <-ch:
-					go func() {
-						innerCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
-						defer cancel()
+// Config возвращает текущую конфигурацию сервиса
+func (s *Service) Config() config.Config {
+	return s.config.Load().(config.Config)
+}
+
+// ApplyConfig заменяет конфигурацию работающего сервиса. Новые значения используются запросами, начатыми после замены.
+// Настройки, прочитанные при запуске (хранилище, ключ авторизации, интервалы фоновых задач и т.д.), не меняются - см. config.Reload
+func (s *Service) ApplyConfig(cfg config.Config) {
+	s.config.Store(cfg)
+}
+
+// Shutdown останавливает фоновые задачи сервиса и ждет их завершения: накопленные запросы на удаление ссылок выполняются, а переходы - записываются,
+// фоновые задачи сокращения ссылок прерываются, а файлы их результатов удаляются (после перезапуска они недоступны).
+// Если ctx отменяется раньше - возвращает его ошибку, не дожидаясь завершения
+func (s *Service) Shutdown(ctx context.Context) error {
+	s.stop()
+	stopped := make(chan struct{})
+	go func() {
+		s.background.Wait()
+		for _, job := range s.shortenJobs.removeAll() {
+			job.removeResult()
+		}
+		<-s.deleteURLsDone
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
 
-						err := s.Repository.DeleteURLs(innerCtx, req.userID, req.ids)
-						if err != nil {
-							log.Error().
-								Err(err).
-								Str("worker", workerID).
-								Strs("ids", req.ids).
-								Str("userID", req.userID).
-								Msg("error while deleting user urls")
-							return
-						}
-						log.Info().
-							Str("worker", workerID).
-							Strs("ids", req.ids).
-							Str("userID", req.userID).
-							Msg("urls deleted")
-					}()
+// urlsPurger окончательно удаляет из хранилища ссылки, удаленные (или истекшие) до момента before
+type urlsPurger func(ctx context.Context, before time.Time) (int, error)
 
+// startURLsSweeper периодически удаляет из хранилища ссылки, удаленные (или истекшие - в зависимости от purge) более чем retention назад.
+// kind - какие ссылки удаляются, для логов
+func (s *Service) startURLsSweeper(ctx context.Context, kind string, interval time.Duration, retention time.Duration, purge urlsPurger) {
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		log.Info().Str("kind", kind).Dur("interval", interval).Dur("retention", retention).Msg("starting urls sweeper")
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				log.Info().Str("kind", kind).Msg("stopping urls sweeper")
+				return
+			case <-ticker.C:
+				innerCtx, cancel := context.WithTimeout(ctx, interval)
+				purged, err := purge(innerCtx, time.Now().Add(-retention))
+				cancel()
+				if err != nil {
+					log.Error().Err(err).Str("kind", kind).Msg("error while purging urls")
+					continue
+				}
+				if purged > 0 {
+					log.Info().Str("kind", kind).Int("count", purged).Msg("urls purged")
 				}
 			}
-		}()
-	}
-	return ch
+		}
+	}()
 }
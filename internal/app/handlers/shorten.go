@@ -42,14 +42,12 @@ func (s *Service) ShortenURLHandler() http.HandlerFunc {
 			return
 		}
 
-		id := s.IDGenerator.GenerateURLID(u.String())
 		urlEntity := repository.URLEntity{
-			ID:          id,
-			OriginalURL: u.String(),
+			OriginalURL: s.normalizeURL(u.String()),
 			UserID:      userID,
 		}
 		status := http.StatusCreated
-		err = s.Repository.Store(r.Context(), urlEntity)
+		id, err := s.storeWithGeneratedID(r.Context(), urlEntity)
 		if err != nil {
 			var errExists *repository.ErrURLExists
 			if !errors.As(err, &errExists) {
@@ -63,7 +61,7 @@ func (s *Service) ShortenURLHandler() http.HandlerFunc {
 
 		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 		w.WriteHeader(status)
-		_, err = w.Write([]byte(fmt.Sprintf("%s/%s", s.Config.BaseURL, id)))
+		_, err = w.Write([]byte(fmt.Sprintf("%s/%s", s.Config().BaseURL, id)))
 		if err != nil {
 			log.Error().Err(err).Msg("could write response")
 		}
@@ -0,0 +1,545 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/middlewares/cookieauth"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// статусы фоновой задачи сокращения ссылок
+const (
+	shortenJobPending = "pending"
+	shortenJobRunning = "running"
+	shortenJobDone    = "done"
+	shortenJobFailed  = "failed"
+)
+
+// maxRunningShortenJobs сколько фоновых задач сокращения ссылок выполняется одновременно, остальные ждут своей очереди
+const maxRunningShortenJobs = 2
+
+// defaultShortenJobsMaxRequestSize размер тела запроса задачи по умолчанию, если ShortenJobsMaxRequestSize не задан
+const defaultShortenJobsMaxRequestSize = 64 << 20
+
+var (
+	errTooManyShortenJobs = errors.New("too many unfinished shorten jobs")
+	errRequestTooLarge    = errors.New("request body too large")
+)
+
+// shortenJob фоновая задача сокращения большого списка ссылок.
+// Тело запроса сохраняется во временный файл и обрабатывается частями по ShortenBatchSize ссылок,
+// результат по каждой ссылке дописывается в файл результата
+type shortenJob struct {
+	id          string
+	userID      string
+	createdAt   time.Time
+	requestFile string
+
+	mx sync.RWMutex
+	// resultFile пустой, если задача завершилась до начала обработки
+	resultFile string
+	status     string
+	counters   shortenJobCounters
+	err        string
+}
+
+type shortenJobCounters struct {
+	Processed int `json:"processed"`
+	Created   int `json:"created"`
+	Exists    int `json:"exists"`
+	Invalid   int `json:"invalid"`
+	Conflict  int `json:"conflict"`
+}
+
+type shortenJobStatusResponse struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	shortenJobCounters
+	Error     string `json:"error,omitempty"`
+	ResultURL string `json:"result_url,omitempty"`
+}
+
+func (j *shortenJob) setStatus(status string) {
+	j.mx.Lock()
+	defer j.mx.Unlock()
+	j.status = status
+}
+
+func (j *shortenJob) setResultFile(name string) {
+	j.mx.Lock()
+	defer j.mx.Unlock()
+	j.resultFile = name
+}
+
+func (j *shortenJob) addResults(results []batchShortenResponseEntity) {
+	j.mx.Lock()
+	defer j.mx.Unlock()
+	for _, result := range results {
+		j.counters.Processed++
+		switch result.Status {
+		case batchItemCreated:
+			j.counters.Created++
+		case batchItemExists:
+			j.counters.Exists++
+		case batchItemInvalid:
+			j.counters.Invalid++
+		case batchItemConflict:
+			j.counters.Conflict++
+		}
+	}
+}
+
+func (j *shortenJob) finish(err error) {
+	j.mx.Lock()
+	defer j.mx.Unlock()
+	if err != nil {
+		j.status = shortenJobFailed
+		j.err = err.Error()
+		return
+	}
+	j.status = shortenJobDone
+}
+
+// result возвращает имя файла результата, если он доступен.
+// Результат доступен и для задачи, завершившейся с ошибкой: в нем ссылки, обработанные до ошибки
+func (j *shortenJob) result() (string, bool) {
+	j.mx.RLock()
+	defer j.mx.RUnlock()
+	return j.resultFile, j.hasResult()
+}
+
+func (j *shortenJob) isFinished() bool {
+	j.mx.RLock()
+	defer j.mx.RUnlock()
+	return j.status == shortenJobDone || j.status == shortenJobFailed
+}
+
+// removeResult удаляет файл результата задачи
+func (j *shortenJob) removeResult() {
+	resultFile, _ := j.result()
+	if resultFile == "" {
+		return
+	}
+	if err := os.Remove(resultFile); err != nil {
+		log.Error().Err(err).Str("jobID", j.id).Msg("could not remove job result file")
+	}
+}
+
+func (j *shortenJob) hasResult() bool {
+	return (j.status == shortenJobDone || j.status == shortenJobFailed) && j.resultFile != ""
+}
+
+func (j *shortenJob) statusResponse(baseURL string) shortenJobStatusResponse {
+	j.mx.RLock()
+	defer j.mx.RUnlock()
+	resp := shortenJobStatusResponse{
+		ID:                 j.id,
+		Status:             j.status,
+		shortenJobCounters: j.counters,
+		Error:              j.err,
+	}
+	if j.hasResult() {
+		resp.ResultURL = fmt.Sprintf("%s/api/shorten/jobs/%s/result", baseURL, j.id)
+	}
+	return resp
+}
+
+// shortenJobStore задачи хранятся только в памяти, после перезапуска сервиса их статус теряется (а файлы результатов удаляются, см. Service.Shutdown)
+type shortenJobStore struct {
+	mx   sync.RWMutex
+	jobs map[string]*shortenJob
+	// running ограничивает количество одновременно выполняемых задач
+	running chan struct{}
+}
+
+func newShortenJobStore() *shortenJobStore {
+	return &shortenJobStore{
+		jobs:    make(map[string]*shortenJob),
+		running: make(chan struct{}, maxRunningShortenJobs),
+	}
+}
+
+// add добавляет задачу, если у ее пользователя меньше limit задач. Иначе вытесняет самую старую завершенную задачу пользователя
+// и возвращает ее (файл ее результата нужно удалить). Если завершенных задач у пользователя нет - возвращает errTooManyShortenJobs
+func (s *shortenJobStore) add(job *shortenJob, limit int) (*shortenJob, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	var count int
+	var oldestFinished *shortenJob
+	for _, j := range s.jobs {
+		if j.userID != job.userID {
+			continue
+		}
+		count++
+		if j.isFinished() && (oldestFinished == nil || j.createdAt.Before(oldestFinished.createdAt)) {
+			oldestFinished = j
+		}
+	}
+	if count < limit {
+		s.jobs[job.id] = job
+		return nil, nil
+	}
+	if oldestFinished == nil {
+		return nil, errTooManyShortenJobs
+	}
+	delete(s.jobs, oldestFinished.id)
+	s.jobs[job.id] = job
+	return oldestFinished, nil
+}
+
+// get возвращает задачу, только если она принадлежит пользователю userID
+func (s *shortenJobStore) get(id string, userID string) (*shortenJob, bool) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	job, ok := s.jobs[id]
+	if !ok || job.userID != userID {
+		return nil, false
+	}
+	return job, true
+}
+
+// remove удаляет задачу, если она еще не вытеснена другой. Возвращает, была ли задача удалена
+func (s *shortenJobStore) remove(job *shortenJob) bool {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if s.jobs[job.id] != job {
+		return false
+	}
+	delete(s.jobs, job.id)
+	return true
+}
+
+// removeAll удаляет все задачи и возвращает их
+func (s *shortenJobStore) removeAll() []*shortenJob {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	jobs := make([]*shortenJob, 0, len(s.jobs))
+	for id, job := range s.jobs {
+		jobs = append(jobs, job)
+		delete(s.jobs, id)
+	}
+	return jobs
+}
+
+// CreateShortenJobHandler принимает список ссылок в формате /api/shorten/batch и запускает его сокращение в фоне.
+// Отвечает 202 со статусом задачи, адрес статуса - в заголовке Location.
+// У пользователя не больше ShortenJobsPerUser задач: новая вытесняет самую старую завершенную, а если все еще выполняются - ответ 429
+func (s *Service) CreateShortenJobHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		userID, err := cookieauth.FromContext(r.Context())
+		if err != nil {
+			log.Info().Err(err).Msg("unauthorized")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		job := &shortenJob{
+			id:        uuid.NewString(),
+			userID:    userID,
+			createdAt: time.Now(),
+			status:    shortenJobPending,
+		}
+		// место под задачу занимаем до записи тела запроса, чтобы не писать на диск то, что не будет обработано
+		evicted, err := s.shortenJobs.add(job, s.shortenJobsPerUser())
+		if err != nil {
+			log.Info().Err(err).Str("userID", userID).Msg("shorten job rejected")
+			http.Error(w, "Too many unfinished jobs", http.StatusTooManyRequests)
+			return
+		}
+		if evicted != nil {
+			evicted.removeResult()
+		}
+		// тело запроса может не поместиться в память, поэтому сразу пишем его на диск, но не больше ShortenJobsMaxRequestSize
+		maxSize := s.shortenJobsMaxRequestSize()
+		body := http.MaxBytesReader(w, r.Body, maxSize)
+		if job.requestFile, err = spoolToTempFile(s.Config().ShortenJobsDir, "shorten-job-request-*.json", body, maxSize); err != nil {
+			s.shortenJobs.remove(job)
+			if errors.Is(err, errRequestTooLarge) {
+				log.Info().Str("userID", userID).Int64("maxSize", maxSize).Msg("shorten job request body too large")
+				http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			log.Error().Err(err).Msg("could not save request body")
+			http.Error(w, "Could not read request body", http.StatusInternalServerError)
+			return
+		}
+		s.background.Add(1)
+		go s.runShortenJob(job)
+
+		serializedResp, err := json.Marshal(job.statusResponse(s.Config().BaseURL))
+		if err != nil {
+			log.Error().Err(err).Msg("can't serialize response")
+			http.Error(w, "Can't serialize response", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Location", fmt.Sprintf("%s/api/shorten/jobs/%s", s.Config().BaseURL, job.id))
+		w.WriteHeader(http.StatusAccepted)
+		if _, err = w.Write(serializedResp); err != nil {
+			log.Error().Err(err).Msg("write response failed")
+		}
+	}
+}
+
+// ShortenJobStatusHandler возвращает статус и прогресс фоновой задачи сокращения ссылок
+func (s *Service) ShortenJobStatusHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		job, ok := s.userShortenJob(w, r)
+		if !ok {
+			return
+		}
+		s.writeShortenJobStatus(w, job, http.StatusOK)
+	}
+}
+
+// ShortenJobResultHandler отдает результат завершенной фоновой задачи в формате ответа /api/shorten/batch.
+// Если результата нет (задача еще выполняется или завершилась до начала обработки) - отвечает 409 со статусом задачи
+func (s *Service) ShortenJobResultHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		job, ok := s.userShortenJob(w, r)
+		if !ok {
+			return
+		}
+		resultFile, ok := job.result()
+		if !ok {
+			s.writeShortenJobStatus(w, job, http.StatusConflict)
+			return
+		}
+
+		file, err := os.Open(resultFile)
+		if err != nil {
+			log.Error().Err(err).Str("jobID", job.id).Msg("could not open job result")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		defer file.Close()
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		if _, err = io.Copy(w, file); err != nil {
+			log.Error().Err(err).Msg("write response failed")
+		}
+	}
+}
+
+func (s *Service) writeShortenJobStatus(w http.ResponseWriter, job *shortenJob, statusCode int) {
+	serializedResp, err := json.Marshal(job.statusResponse(s.Config().BaseURL))
+	if err != nil {
+		log.Error().Err(err).Msg("can't serialize response")
+		http.Error(w, "Can't serialize response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(statusCode)
+	if _, err = w.Write(serializedResp); err != nil {
+		log.Error().Err(err).Msg("write response failed")
+	}
+}
+
+func (s *Service) shortenJobsPerUser() int {
+	if s.Config().ShortenJobsPerUser < 1 {
+		return 1
+	}
+	return s.Config().ShortenJobsPerUser
+}
+
+func (s *Service) shortenJobsMaxRequestSize() int64 {
+	if s.Config().ShortenJobsMaxRequestSize < 1 {
+		return defaultShortenJobsMaxRequestSize
+	}
+	return s.Config().ShortenJobsMaxRequestSize
+}
+
+// userShortenJob находит задачу из параметра запроса jobID. Чужие задачи не отличаются от несуществующих
+func (s *Service) userShortenJob(w http.ResponseWriter, r *http.Request) (*shortenJob, bool) {
+	userID, err := cookieauth.FromContext(r.Context())
+	if err != nil {
+		log.Info().Err(err).Msg("unauthorized")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	job, ok := s.shortenJobs.get(chi.URLParam(r, "jobID"), userID)
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return nil, false
+	}
+	return job, true
+}
+
+// runShortenJob выполняет задачу, когда освобождается место среди выполняемых. При остановке сервиса задача прерывается,
+// а задачи, созданные после остановки, не запускаются
+func (s *Service) runShortenJob(job *shortenJob) {
+	defer s.background.Done()
+	err := s.ctx.Err()
+	if err == nil {
+		select {
+		case s.shortenJobs.running <- struct{}{}:
+			defer func() { <-s.shortenJobs.running }()
+			log.Info().Str("jobID", job.id).Msg("shorten job started")
+			job.setStatus(shortenJobRunning)
+			err = s.processShortenJob(s.ctx, job)
+		case <-s.ctx.Done():
+			err = s.ctx.Err()
+		}
+	}
+	if removeErr := os.Remove(job.requestFile); removeErr != nil {
+		log.Error().Err(removeErr).Str("jobID", job.id).Msg("could not remove job request file")
+	}
+	job.finish(err)
+	if err != nil {
+		log.Error().Err(err).Str("jobID", job.id).Msg("shorten job failed")
+	} else {
+		log.Info().Str("jobID", job.id).Msg("shorten job finished")
+	}
+
+	if s.Config().ShortenJobsRetention <= 0 {
+		return
+	}
+	time.AfterFunc(s.Config().ShortenJobsRetention, func() {
+		if s.shortenJobs.remove(job) {
+			job.removeResult()
+		}
+	})
+}
+
+// processShortenJob читает список ссылок потоково и сокращает его частями, чтобы не держать весь список в памяти
+func (s *Service) processShortenJob(ctx context.Context, job *shortenJob) error {
+	requestFile, err := os.Open(job.requestFile)
+	if err != nil {
+		return err
+	}
+	defer requestFile.Close()
+
+	resultFile, err := os.CreateTemp(s.Config().ShortenJobsDir, "shorten-job-result-*.json")
+	if err != nil {
+		return err
+	}
+	defer resultFile.Close()
+	job.setResultFile(resultFile.Name())
+
+	result := newJSONArrayWriter(bufio.NewWriter(resultFile))
+	err = s.shortenJobItems(ctx, job, json.NewDecoder(requestFile), result)
+	// массив закрываем и при ошибке, чтобы результат по уже обработанным ссылкам оставался корректным json
+	if closeErr := result.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (s *Service) shortenJobItems(ctx context.Context, job *shortenJob, dec *json.Decoder, result *jsonArrayWriter) error {
+	if err := expectDelim(dec, '['); err != nil {
+		return err
+	}
+	shortener := s.newBatchStreamShortener(job.userID, func(_ batchShortenRequest, results []batchShortenResponseEntity) error {
+		for _, item := range results {
+			if err := result.Write(item); err != nil {
+				return err
+			}
+		}
+		job.addResults(results)
+		return nil
+	})
+	for dec.More() {
+		var reqEntity batchShortenRequestEntity
+		if err := dec.Decode(&reqEntity); err != nil {
+			return fmt.Errorf("invalid json after %d items: %w", shortener.Received(), err)
+		}
+		if err := shortener.Add(ctx, reqEntity); err != nil {
+			return err
+		}
+	}
+	if err := shortener.Flush(ctx); err != nil {
+		return err
+	}
+	return expectDelim(dec, ']')
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("invalid json: %w", err)
+	}
+	if token != delim {
+		return fmt.Errorf("invalid json: expected %s", delim)
+	}
+	return nil
+}
+
+// spoolToTempFile сохраняет содержимое r во временный файл в каталоге dir и возвращает его имя.
+// r ограничен http.MaxBytesReader размером maxSize: ошибка чтения после maxSize байт означает, что тело больше допустимого,
+// и возвращается errRequestTooLarge (http.MaxBytesError появилась только в go 1.19)
+func spoolToTempFile(dir string, pattern string, r io.Reader, maxSize int64) (string, error) {
+	file, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return "", err
+	}
+	written, err := io.Copy(file, r)
+	if err != nil && written >= maxSize {
+		err = errRequestTooLarge
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		if removeErr := os.Remove(file.Name()); removeErr != nil {
+			log.Error().Err(removeErr).Msg("could not remove temp file")
+		}
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// jsonArrayWriter потоково записывает элементы json-массива
+type jsonArrayWriter struct {
+	w     *bufio.Writer
+	count int
+}
+
+func newJSONArrayWriter(w *bufio.Writer) *jsonArrayWriter {
+	return &jsonArrayWriter{w: w}
+}
+
+func (a *jsonArrayWriter) Write(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	separator := ",\n"
+	if a.count == 0 {
+		separator = "[\n"
+	}
+	if _, err = a.w.WriteString(separator); err != nil {
+		return err
+	}
+	if _, err = a.w.Write(data); err != nil {
+		return err
+	}
+	a.count++
+	return nil
+}
+
+// Close дописывает конец массива. Writer, в который ничего не записано, выдает пустой массив
+func (a *jsonArrayWriter) Close() error {
+	end := "\n]\n"
+	if a.count == 0 {
+		end = "[]\n"
+	}
+	if _, err := a.w.WriteString(end); err != nil {
+		return err
+	}
+	if err := a.w.Flush(); err != nil {
+		return fmt.Errorf("could not write job result: %w", err)
+	}
+	return nil
+}
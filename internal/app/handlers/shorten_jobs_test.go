@@ -0,0 +1,197 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/config"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/handlers"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/repository"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/repository/mocks"
+	shortenerMocks "github.com/thorgnir-go-study/go-musthave-shortener/internal/app/shortener/mocks"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+)
+
+var _ = Describe("ShortenJobs", func() {
+	var ts *httptest.Server
+	var urlRepositoryMock *mocks.URLRepository
+	var idGeneratorMock *shortenerMocks.URLIDGenerator
+	var cookie *http.Cookie
+	var service *handlers.Service
+	var jobsDir string
+
+	BeforeEach(func() {
+		urlRepositoryMock = new(mocks.URLRepository)
+		idGeneratorMock = new(shortenerMocks.URLIDGenerator)
+		jobsDir = GinkgoT().TempDir()
+		cfg := config.Config{
+			BaseURL:                   "http://localhost:8080",
+			ShortenBatchSize:          2,
+			ShortenMaxAttempts:        3,
+			ShortenJobsDir:            jobsDir,
+			ShortenJobsPerUser:        1,
+			ShortenJobsMaxRequestSize: 1024,
+		}
+
+		service = handlers.NewService(urlRepositoryMock, idGeneratorMock, cfg)
+		r := handlers.NewRouter(service)
+		ts = httptest.NewServer(r)
+
+		urlRepositoryMock.On("LoadByUserID", mock.Anything, mock.Anything).Return([]repository.URLEntity{}, nil).Once()
+		res := testGetList(ts, nil)
+		cookie = res.Cookies()[0]
+	})
+	AfterEach(func() {
+		ts.Close()
+	})
+
+	createJob := func(body string) string {
+		res := testRequest(ts, "POST", "/api/shorten/jobs", []*http.Cookie{cookie}, strings.NewReader(body))
+		defer res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusAccepted))
+		var status map[string]interface{}
+		Expect(json.NewDecoder(res.Body).Decode(&status)).To(Succeed())
+		Expect(res.Header.Get("Location")).To(Equal("http://localhost:8080/api/shorten/jobs/" + status["id"].(string)))
+		return status["id"].(string)
+	}
+	jobStatus := func(id string) map[string]interface{} {
+		res := testRequest(ts, "GET", "/api/shorten/jobs/"+id, []*http.Cookie{cookie}, nil)
+		defer res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusOK))
+		var status map[string]interface{}
+		Expect(json.NewDecoder(res.Body).Decode(&status)).To(Succeed())
+		return status
+	}
+
+	When("batch is valid", func() {
+		BeforeEach(func() {
+			idGeneratorMock.On("GenerateURLID", mock.Anything, "http://google.com", mock.Anything).Return("shortGoogle", nil).Once()
+			idGeneratorMock.On("GenerateURLID", mock.Anything, "http://yandex.ru", mock.Anything).Return("shortYandex", nil).Once()
+			idGeneratorMock.On("GenerateURLID", mock.Anything, "http://ya.ru", mock.Anything).Return("shortYa", nil).Once()
+			// ссылки сохраняются частями по ShortenBatchSize
+			urlRepositoryMock.On("StoreBatch", mock.Anything, mock.MatchedBy(func(b []repository.URLEntity) bool {
+				return len(b) == 1 && b[0].ID == "shortGoogle"
+			})).Return([]error{nil}, nil).Once()
+			urlRepositoryMock.On("StoreBatch", mock.Anything, mock.MatchedBy(func(b []repository.URLEntity) bool {
+				return len(b) == 2 && b[0].ID == "shortYandex" && b[1].ID == "shortYa"
+			})).Return([]error{nil, repository.NewErrURLExists("existingYa")}, nil).Once()
+		})
+
+		It("should process batch in background and return result", func() {
+			id := createJob(`[
+{"original_url": "http://google.com", "correlation_id": "1"},
+{"original_url": "some text", "correlation_id": "2"},
+{"original_url": "http://yandex.ru", "correlation_id": "3"},
+{"original_url": "http://ya.ru", "correlation_id": "4"}
+]`)
+			Eventually(func() interface{} { return jobStatus(id)["status"] }).Should(Equal("done"))
+			Expect(jobStatus(id)).To(And(
+				HaveKeyWithValue("processed", BeEquivalentTo(4)),
+				HaveKeyWithValue("created", BeEquivalentTo(2)),
+				HaveKeyWithValue("exists", BeEquivalentTo(1)),
+				HaveKeyWithValue("invalid", BeEquivalentTo(1)),
+				HaveKeyWithValue("result_url", "http://localhost:8080/api/shorten/jobs/"+id+"/result"),
+			))
+
+			res := testRequest(ts, "GET", "/api/shorten/jobs/"+id+"/result", []*http.Cookie{cookie}, nil)
+			defer res.Body.Close()
+			Expect(res.StatusCode).To(Equal(http.StatusOK))
+			body, err := io.ReadAll(res.Body)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(body).To(MatchJSON(`[
+{"short_url":"http://localhost:8080/shortGoogle", "correlation_id": "1", "status": "created"},
+{"correlation_id": "2", "status": "invalid", "error": "invalid url some text"},
+{"short_url":"http://localhost:8080/shortYandex", "correlation_id": "3", "status": "created"},
+{"short_url":"http://localhost:8080/existingYa", "correlation_id": "4", "status": "exists", "error": "url is already shortened"}
+]`))
+			urlRepositoryMock.AssertExpectations(GinkgoT())
+		})
+	})
+
+	When("body is not a json array", func() {
+		It("should fail job", func() {
+			id := createJob(`{"original_url": "http://google.com"}`)
+			Eventually(func() interface{} { return jobStatus(id)["status"] }).Should(Equal("failed"))
+			Expect(jobStatus(id)).To(HaveKey("error"))
+		})
+	})
+
+	When("job is finished before processing", func() {
+		It("should respond 409 with job status instead of result", func() {
+			Expect(service.Shutdown(context.Background())).To(Succeed())
+			id := createJob(`[{"original_url": "http://google.com", "correlation_id": "1"}]`)
+			Eventually(func() interface{} { return jobStatus(id)["status"] }).Should(Equal("failed"))
+			Expect(jobStatus(id)).NotTo(HaveKey("result_url"))
+
+			res := testRequest(ts, "GET", "/api/shorten/jobs/"+id+"/result", []*http.Cookie{cookie}, nil)
+			defer res.Body.Close()
+			Expect(res.StatusCode).To(Equal(http.StatusConflict))
+			var status map[string]interface{}
+			Expect(json.NewDecoder(res.Body).Decode(&status)).To(Succeed())
+			Expect(status).To(And(
+				HaveKeyWithValue("id", id),
+				HaveKeyWithValue("status", "failed"),
+				HaveKeyWithValue("error", "context canceled"),
+			))
+		})
+	})
+
+	When("user has too many jobs", func() {
+		var release chan struct{}
+		BeforeEach(func() {
+			release = make(chan struct{})
+			idGeneratorMock.On("GenerateURLID", mock.Anything, "http://google.com", mock.Anything).Return("shortGoogle", nil)
+			urlRepositoryMock.On("StoreBatch", mock.Anything, mock.Anything).Run(func(mock.Arguments) {
+				<-release
+			}).Return([]error{nil}, nil)
+		})
+
+		It("should reject new job while previous is running and evict it when finished", func() {
+			first := createJob(`[{"original_url": "http://google.com", "correlation_id": "1"}]`)
+			res := testRequest(ts, "POST", "/api/shorten/jobs", []*http.Cookie{cookie}, strings.NewReader(`[]`))
+			res.Body.Close()
+			Expect(res.StatusCode).To(Equal(http.StatusTooManyRequests))
+
+			close(release)
+			Eventually(func() interface{} { return jobStatus(first)["status"] }).Should(Equal("done"))
+			Expect(os.ReadDir(jobsDir)).To(HaveLen(1), "only result file of finished job should be kept")
+
+			second := createJob(`[]`)
+			res = testRequest(ts, "GET", "/api/shorten/jobs/"+first, []*http.Cookie{cookie}, nil)
+			res.Body.Close()
+			Expect(res.StatusCode).To(Equal(http.StatusNotFound))
+			Eventually(func() interface{} { return jobStatus(second)["status"] }).Should(Equal("done"))
+			Expect(os.ReadDir(jobsDir)).To(HaveLen(1), "result file of evicted job should be removed")
+
+			Expect(service.Shutdown(context.Background())).To(Succeed())
+			Expect(os.ReadDir(jobsDir)).To(BeEmpty(), "result files should be removed on shutdown")
+		})
+	})
+
+	When("body is too large", func() {
+		It("should respond 413 without keeping the job", func() {
+			body := `[` + strings.Repeat(`{"original_url": "http://google.com", "correlation_id": "1"},`, 50) + `]`
+			res := testRequest(ts, "POST", "/api/shorten/jobs", []*http.Cookie{cookie}, strings.NewReader(body))
+			res.Body.Close()
+			Expect(res.StatusCode).To(Equal(http.StatusRequestEntityTooLarge))
+			Expect(os.ReadDir(jobsDir)).To(BeEmpty(), "request file should be removed")
+
+			createJob(`[]`)
+		})
+	})
+
+	When("job belongs to another user", func() {
+		It("should respond 404", func() {
+			id := createJob(`[]`)
+			res := testRequest(ts, "GET", "/api/shorten/jobs/"+id, nil, nil)
+			defer res.Body.Close()
+			Expect(res.StatusCode).To(Equal(http.StatusNotFound))
+		})
+	})
+})
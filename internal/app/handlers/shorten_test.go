@@ -1,18 +1,22 @@
 package handlers
 
 import (
+	"context"
 	"errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/config"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/repository"
 	repositoryMocks "github.com/thorgnir-go-study/go-musthave-shortener/internal/app/repository/mocks"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/shortener"
 	shortenerMocks "github.com/thorgnir-go-study/go-musthave-shortener/internal/app/shortener/mocks"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 func Test_ShortenURLHandler(t *testing.T) {
@@ -52,7 +56,57 @@ func Test_ShortenURLHandler(t *testing.T) {
 			}(),
 			idGenerator: func() *shortenerMocks.URLIDGenerator {
 				gen := new(shortenerMocks.URLIDGenerator)
-				gen.On("GenerateURLID", "http://google.com").Return("shortGoogle").Once()
+				gen.On("GenerateURLID", mock.Anything, "http://google.com", mock.Anything).Return("shortGoogle", nil).Once()
+				return gen
+			}(),
+		},
+		{
+			name: "should regenerate id on collision and grow its length",
+			request: request{
+				url:    "/",
+				method: http.MethodPost,
+				body:   "http://google.com",
+			},
+			want: want{
+				contentType: "text/plain; charset=utf-8",
+				statusCode:  http.StatusCreated,
+				body:        "http://localhost:8080/longerGoogle",
+			},
+			storage: func() *repositoryMocks.URLRepository {
+				urlStorage := new(repositoryMocks.URLRepository)
+				urlStorage.On("Store", mock.Anything, mock.MatchedBy(func(e repository.URLEntity) bool {
+					return e.ID == "taken"
+				})).Return(repository.NewErrURLIDConflict("taken")).Twice()
+				urlStorage.On("Store", mock.Anything, mock.MatchedBy(func(e repository.URLEntity) bool {
+					return e.ID == "longerGoogle"
+				})).Return(nil).Once()
+				return urlStorage
+			}(),
+			idGenerator: func() *shortenerMocks.URLIDGenerator {
+				gen := new(shortenerMocks.URLIDGenerator)
+				gen.On("GenerateURLID", mock.Anything, "http://google.com", 10).Return("taken", nil).Twice()
+				gen.On("GenerateURLID", mock.Anything, "http://google.com", 11).Return("longerGoogle", nil).Once()
+				return gen
+			}(),
+		},
+		{
+			name: "should respond 500 when collisions exceed max attempts",
+			request: request{
+				url:    "/",
+				method: http.MethodPost,
+				body:   "http://google.com",
+			},
+			want: want{
+				statusCode: http.StatusInternalServerError,
+			},
+			storage: func() *repositoryMocks.URLRepository {
+				urlStorage := new(repositoryMocks.URLRepository)
+				urlStorage.On("Store", mock.Anything, mock.Anything).Return(repository.NewErrURLIDConflict("taken")).Times(3)
+				return urlStorage
+			}(),
+			idGenerator: func() *shortenerMocks.URLIDGenerator {
+				gen := new(shortenerMocks.URLIDGenerator)
+				gen.On("GenerateURLID", mock.Anything, "http://google.com", mock.Anything).Return("taken", nil).Times(3)
 				return gen
 			}(),
 		},
@@ -106,7 +160,7 @@ func Test_ShortenURLHandler(t *testing.T) {
 			}(),
 			idGenerator: func() *shortenerMocks.URLIDGenerator {
 				gen := new(shortenerMocks.URLIDGenerator)
-				gen.On("GenerateURLID", "http://google.com").Return("shortGoogle").Once()
+				gen.On("GenerateURLID", mock.Anything, "http://google.com", mock.Anything).Return("shortGoogle", nil).Once()
 				return gen
 			}(),
 		},
@@ -124,7 +178,9 @@ func Test_ShortenURLHandler(t *testing.T) {
 				gen = new(shortenerMocks.URLIDGenerator)
 			}
 			cfg := config.Config{
-				BaseURL: baseURL,
+				BaseURL:                  baseURL,
+				ShortURLIdentifierLength: 10,
+				ShortenMaxAttempts:       3,
 			}
 
 			service := NewService(st, gen, cfg)
@@ -146,3 +202,149 @@ func Test_ShortenURLHandler(t *testing.T) {
 	}
 
 }
+
+func Test_ApplyConfig(t *testing.T) {
+	st := new(repositoryMocks.URLRepository)
+	st.On("Store", mock.Anything, mock.Anything).Return(nil).Twice()
+	gen := new(shortenerMocks.URLIDGenerator)
+	gen.On("GenerateURLID", mock.Anything, "http://google.com", 10).Return("shortGoogle", nil).Once()
+	gen.On("GenerateURLID", mock.Anything, "http://google.com", 12).Return("longerGoogle", nil).Once()
+	cfg := config.Config{
+		BaseURL:                  "http://localhost:8080",
+		ShortURLIdentifierLength: 10,
+		ShortenMaxAttempts:       3,
+	}
+
+	service := NewService(st, gen, cfg)
+	ts := httptest.NewServer(NewRouter(service))
+	defer ts.Close()
+	shorten := func() string {
+		res := testRequest(t, ts, http.MethodPost, "/", strings.NewReader("http://google.com"))
+		defer res.Body.Close()
+		require.Equal(t, http.StatusCreated, res.StatusCode)
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	assert.Equal(t, "http://localhost:8080/shortGoogle", shorten())
+
+	cfg.BaseURL = "https://short.example"
+	cfg.ShortURLIdentifierLength = 12
+	service.ApplyConfig(cfg)
+	assert.Equal(t, "https://short.example/longerGoogle", shorten())
+	assert.Equal(t, cfg, service.Config())
+	gen.AssertExpectations(t)
+}
+
+func Test_ShortenURLHandler_ExpiredURL(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		body string
+		want string
+	}{
+		{
+			name: "should shorten url whose existing link is expired",
+			path: "/",
+			body: "http://google.com",
+			want: "http://localhost:8080/newGoogle",
+		},
+		{
+			name: "should shorten url whose existing link is expired via json api",
+			path: "/api/shorten",
+			body: `{"url": "http://google.com"}`,
+			want: `{"result":"http://localhost:8080/newGoogle"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st, err := repository.NewInMemoryRepository()
+			require.NoError(t, err)
+			expiresAt := time.Now().Add(-time.Hour)
+			require.NoError(t, st.Store(context.Background(), repository.URLEntity{ID: "oldGoogle", OriginalURL: "http://google.com", UserID: "user", ExpiresAt: &expiresAt}))
+			gen := new(shortenerMocks.URLIDGenerator)
+			gen.On("GenerateURLID", mock.Anything, "http://google.com", mock.Anything).Return("newGoogle", nil).Once()
+			cfg := config.Config{
+				BaseURL:                  "http://localhost:8080",
+				ShortURLIdentifierLength: 10,
+				ShortenMaxAttempts:       3,
+			}
+
+			ts := httptest.NewServer(NewRouter(NewService(st, gen, cfg)))
+			defer ts.Close()
+			res := testRequest(t, ts, http.MethodPost, tt.path, strings.NewReader(tt.body))
+			body, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusCreated, res.StatusCode)
+			assert.Equal(t, tt.want, strings.TrimSpace(string(body)))
+
+			res = testRequest(t, ts, http.MethodGet, "/newGoogle", nil)
+			res.Body.Close()
+			assert.Equal(t, http.StatusTemporaryRedirect, res.StatusCode)
+			assert.Equal(t, "http://google.com", res.Header.Get("Location"))
+		})
+	}
+}
+
+func Test_ShortenURLHandler_HashCollision(t *testing.T) {
+	gen := shortener.NewHashURLIDGenerator("secret")
+	id, err := gen.GenerateURLID(context.Background(), "http://google.com", 11)
+	require.NoError(t, err)
+	st := new(repositoryMocks.URLRepository)
+	st.On("Store", mock.Anything, mock.MatchedBy(func(e repository.URLEntity) bool {
+		return e.ID == id[:10]
+	})).Return(repository.NewErrURLIDConflict(id[:10])).Once()
+	st.On("Store", mock.Anything, mock.MatchedBy(func(e repository.URLEntity) bool {
+		return e.ID == id
+	})).Return(nil).Once()
+	cfg := config.Config{
+		BaseURL:                  "http://localhost:8080",
+		ShortURLIdentifierLength: 10,
+		ShortenMaxAttempts:       3,
+	}
+
+	ts := httptest.NewServer(NewRouter(NewService(st, gen, cfg)))
+	defer ts.Close()
+	res := testRequest(t, ts, http.MethodPost, "/", strings.NewReader("http://google.com"))
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+	assert.Equal(t, "http://localhost:8080/"+id, string(body))
+	st.AssertExpectations(t)
+}
+
+func Test_ShortenURLHandler_HashNormalizedURL(t *testing.T) {
+	st, err := repository.NewInMemoryRepository()
+	require.NoError(t, err)
+	gen := shortener.NewHashURLIDGenerator("secret")
+	id, err := gen.GenerateURLID(context.Background(), "http://google.com", 10)
+	require.NoError(t, err)
+	cfg := config.Config{
+		BaseURL:                  "http://localhost:8080",
+		ShortURLIdentifierLength: 10,
+		ShortenMaxAttempts:       3,
+	}
+
+	ts := httptest.NewServer(NewRouter(NewService(st, gen, cfg)))
+	defer ts.Close()
+	res := testRequest(t, ts, http.MethodPost, "/", strings.NewReader("HTTP://Google.COM:80"))
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+	assert.Equal(t, "http://localhost:8080/"+id, string(body))
+
+	res = testRequest(t, ts, http.MethodPost, "/", strings.NewReader("http://google.com/"))
+	body, err = io.ReadAll(res.Body)
+	res.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, res.StatusCode, "same normalized url should be reported as existing")
+	assert.Equal(t, "http://localhost:8080/"+id, string(body))
+
+	stored, err := st.Load(context.Background(), id)
+	require.NoError(t, err)
+	assert.Equal(t, "http://google.com/", stored.OriginalURL)
+}
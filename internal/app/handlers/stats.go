@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/middlewares/cookieauth"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/repository"
+	"net/http"
+)
+
+type dailyClicksResponseEntity struct {
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+}
+
+type urlStatsResponse struct {
+	ShortURL    string                      `json:"short_url"`
+	OriginalURL string                      `json:"original_url"`
+	Total       int                         `json:"total"`
+	Daily       []dailyClicksResponseEntity `json:"daily"`
+}
+
+// URLStatsHandler возвращает статистику переходов по ссылке, созданной текущим пользователем
+func (s *Service) URLStatsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.ClickRepository == nil {
+			http.Error(w, "Statistics is not supported by url repository", http.StatusNotImplemented)
+			return
+		}
+
+		userID, err := cookieauth.FromContext(r.Context())
+		if err != nil {
+			log.Info().Err(err).Msg("unauthorized")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		urlID := chi.URLParam(r, "urlID")
+		urlEntity, err := s.Repository.Load(r.Context(), urlID)
+		if err != nil && !errors.Is(err, repository.ErrURLNotFound) {
+			log.Error().Err(err).Msg("error while loading shortened link")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		// чужие ссылки не отличаем от несуществующих, чтобы не раскрывать их наличие
+		if err != nil || urlEntity.UserID != userID {
+			http.NotFound(w, r)
+			return
+		}
+
+		stats, err := s.ClickRepository.LoadStats(r.Context(), urlID)
+		if err != nil {
+			log.Error().Err(err).Msg("error while loading url stats")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		resp := urlStatsResponse{
+			ShortURL:    fmt.Sprintf("%s/%s", s.Config().BaseURL, urlID),
+			OriginalURL: urlEntity.OriginalURL,
+			Total:       stats.Total,
+			Daily:       make([]dailyClicksResponseEntity, len(stats.Daily)),
+		}
+		for idx, d := range stats.Daily {
+			resp.Daily[idx] = dailyClicksResponseEntity{
+				Date:  d.Date.Format("2006-01-02"),
+				Count: d.Count,
+			}
+		}
+
+		serializedResp, err := json.Marshal(resp)
+		if err != nil {
+			log.Error().Err(err).Msg("error while serializing response")
+			http.Error(w, "Can't serialize response", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_, err = w.Write(serializedResp)
+		if err != nil {
+			log.Error().Err(err).Msg("write response failed")
+		}
+	}
+}
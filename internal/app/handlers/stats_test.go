@@ -0,0 +1,120 @@
+package handlers_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/config"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/handlers"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/repository"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/repository/mocks"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+)
+
+// repositoryWithClicksMock хранилище ссылок, поддерживающее сбор статистики переходов
+type repositoryWithClicksMock struct {
+	*mocks.URLRepository
+	*mocks.ClickRepository
+}
+
+var _ = Describe("URLStats", func() {
+	var ts *httptest.Server
+	var urlRepositoryMock *mocks.URLRepository
+	var clickRepositoryMock *mocks.ClickRepository
+	var cookie *http.Cookie
+	var userID string
+
+	BeforeEach(func() {
+		urlRepositoryMock = new(mocks.URLRepository)
+		clickRepositoryMock = new(mocks.ClickRepository)
+		cfg := config.Config{BaseURL: "http://localhost:8080"}
+
+		service := handlers.NewService(repositoryWithClicksMock{urlRepositoryMock, clickRepositoryMock}, nil, cfg)
+		r := handlers.NewRouter(service)
+		ts = httptest.NewServer(r)
+
+		// делаем запрос без куки, чтобы получить значение для нее
+		urlRepositoryMock.On("LoadByUserID", mock.Anything, mock.Anything).Return([]repository.URLEntity{}, nil).Once()
+		res := testGetList(ts, nil)
+		cookie = res.Cookies()[0]
+		userID = strings.Split(cookie.Value, ":")[0]
+	})
+	AfterEach(func() {
+		ts.Close()
+	})
+
+	When("url belongs to user", func() {
+		BeforeEach(func() {
+			urlRepositoryMock.On("Load", mock.Anything, "123").Return(repository.URLEntity{ID: "123", OriginalURL: "http://google.com", UserID: userID}, nil).Once()
+			clickRepositoryMock.On("LoadStats", mock.Anything, "123").Return(repository.URLStats{
+				Total: 3,
+				Daily: []repository.DailyClicks{
+					{Date: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), Count: 1},
+					{Date: time.Date(2022, 1, 2, 0, 0, 0, 0, time.UTC), Count: 2},
+				},
+			}, nil).Once()
+		})
+
+		It("should return url stats", func() {
+			var expectedJSON = `{
+"short_url": "http://localhost:8080/123",
+"original_url": "http://google.com",
+"total": 3,
+"daily": [{"date": "2022-01-01", "count": 1}, {"date": "2022-01-02", "count": 2}]
+}`
+			res := testRequest(ts, "GET", "/api/user/urls/123/stats", []*http.Cookie{cookie}, nil)
+			Expect(res.StatusCode).To(Equal(200))
+			body, err := io.ReadAll(res.Body)
+			defer res.Body.Close()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(body).To(MatchJSON(expectedJSON))
+		})
+	})
+
+	When("url belongs to another user", func() {
+		BeforeEach(func() {
+			urlRepositoryMock.On("Load", mock.Anything, "123").Return(repository.URLEntity{ID: "123", OriginalURL: "http://google.com", UserID: "another"}, nil).Once()
+		})
+
+		It("should respond 404", func() {
+			res := testRequest(ts, "GET", "/api/user/urls/123/stats", []*http.Cookie{cookie}, nil)
+			Expect(res.StatusCode).To(Equal(404))
+			clickRepositoryMock.AssertNotCalled(GinkgoT(), "LoadStats", mock.Anything, mock.Anything)
+		})
+	})
+
+	When("url is expanded", func() {
+		var recorded chan struct{}
+		BeforeEach(func() {
+			recorded = make(chan struct{})
+			urlRepositoryMock.On("Load", mock.Anything, "123").Return(repository.URLEntity{ID: "123", OriginalURL: "http://google.com", UserID: userID}, nil).Once()
+			clickRepositoryMock.On("RecordClick", mock.Anything, mock.MatchedBy(func(c repository.Click) bool {
+				return c.URLID == "123" && c.Referrer == "http://referrer.com"
+			})).Run(func(mock.Arguments) {
+				close(recorded)
+			}).Return(nil).Once()
+		})
+
+		It("should record click", func() {
+			req, err := http.NewRequest("GET", ts.URL+"/123", nil)
+			Expect(err).NotTo(HaveOccurred())
+			req.Header.Set("Referer", "http://referrer.com")
+			c := &http.Client{
+				CheckRedirect: func(req *http.Request, via []*http.Request) error {
+					return http.ErrUseLastResponse
+				},
+			}
+			res, err := c.Do(req)
+			Expect(err).NotTo(HaveOccurred())
+			defer res.Body.Close()
+			Expect(res.StatusCode).To(Equal(http.StatusTemporaryRedirect))
+			// переход записывается в фоне, после ответа
+			Eventually(recorded).Should(BeClosed())
+			clickRepositoryMock.AssertExpectations(GinkgoT())
+		})
+	})
+})
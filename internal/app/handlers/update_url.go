@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/middlewares/cookieauth"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/repository"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+type updateURLRequest struct {
+	URL string `json:"url"`
+}
+
+// UpdateURLHandler меняет оригинальную ссылку у ссылки, созданной текущим пользователем.
+// Если новая оригинальная ссылка уже сокращена - отвечает 409 с ее короткой ссылкой, как и при сокращении
+func (s *Service) UpdateURLHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bodyContent, err := io.ReadAll(r.Body)
+		defer r.Body.Close()
+		if err != nil {
+			log.Error().Err(err).Msg("could not read request body")
+			http.Error(w, "Could not read request body", http.StatusInternalServerError)
+			return
+		}
+
+		var req updateURLRequest
+		if err = json.Unmarshal(bodyContent, &req); err != nil {
+			log.Info().Err(err).Msg("invalid json")
+			http.Error(w, "Invalid json", http.StatusBadRequest)
+			return
+		}
+		u, err := url.ParseRequestURI(req.URL)
+		if err != nil || !u.IsAbs() {
+			log.Info().Str("url", req.URL).Msg("not a valid url")
+			http.Error(w, "Not a valid url", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := cookieauth.FromContext(r.Context())
+		if err != nil {
+			log.Info().Err(err).Msg("unauthorized")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		urlID := chi.URLParam(r, "urlID")
+		// ссылка сохраняется в том же виде, что и при сокращении
+		urlEntity, err := s.Repository.UpdateOriginalURL(r.Context(), userID, urlID, s.normalizeURL(u.String()))
+		var errExists *repository.ErrURLExists
+		switch {
+		case errors.Is(err, repository.ErrURLNotFound):
+			// чужие ссылки не отличаем от несуществующих, чтобы не раскрывать их наличие
+			http.NotFound(w, r)
+			return
+		case errors.As(err, &errExists):
+			log.Info().Err(err).Str("urlID", urlID).Msg("url is already shortened")
+			writeJSONResponse(w, http.StatusConflict, &jsonShortenResponse{Result: fmt.Sprintf("%s/%s", s.Config().BaseURL, errExists.ID)})
+			return
+		case err != nil:
+			log.Error().Err(err).Msg("could not update url in repository")
+			http.Error(w, "Could not update url in repository", http.StatusInternalServerError)
+			return
+		}
+
+		writeJSONResponse(w, http.StatusOK, responseEntity{
+			ShortURL:    fmt.Sprintf("%s/%s", s.Config().BaseURL, urlEntity.ID),
+			OriginalURL: urlEntity.OriginalURL,
+			CreatedAt:   optionalTime(urlEntity.CreatedAt),
+			UpdatedAt:   optionalTime(urlEntity.UpdatedAt),
+			DeletedAt:   urlEntity.DeletedAt,
+		})
+	}
+}
+
+func writeJSONResponse(w http.ResponseWriter, status int, resp interface{}) {
+	serializedResp, err := json.Marshal(resp)
+	if err != nil {
+		log.Error().Err(err).Msg("error while serializing response")
+		http.Error(w, "Can't serialize response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if _, err = w.Write(serializedResp); err != nil {
+		log.Error().Err(err).Msg("write response failed")
+	}
+}
@@ -0,0 +1,122 @@
+package handlers_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/config"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/handlers"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/repository"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/repository/mocks"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+)
+
+var _ = Describe("UpdateURL", func() {
+	var ts *httptest.Server
+	var urlRepositoryMock *mocks.URLRepository
+	var cookie *http.Cookie
+	var userID string
+
+	BeforeEach(func() {
+		urlRepositoryMock = new(mocks.URLRepository)
+		cfg := config.Config{BaseURL: "http://localhost:8080"}
+
+		service := handlers.NewService(urlRepositoryMock, nil, cfg)
+		r := handlers.NewRouter(service)
+		ts = httptest.NewServer(r)
+
+		urlRepositoryMock.On("LoadByUserID", mock.Anything, mock.Anything).Return([]repository.URLEntity{}, nil).Once()
+		res := testGetList(ts, nil)
+		cookie = res.Cookies()[0]
+		userID = strings.Split(cookie.Value, ":")[0]
+	})
+	AfterEach(func() {
+		ts.Close()
+	})
+
+	patch := func(id string, body string) (int, string) {
+		res := testRequest(ts, "PATCH", "/api/user/urls/"+id, []*http.Cookie{cookie}, strings.NewReader(body))
+		defer res.Body.Close()
+		respBody, err := io.ReadAll(res.Body)
+		Expect(err).NotTo(HaveOccurred())
+		return res.StatusCode, string(respBody)
+	}
+
+	When("url belongs to user", func() {
+		BeforeEach(func() {
+			created := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+			urlRepositoryMock.On("UpdateOriginalURL", mock.Anything, userID, "123", "http://yandex.ru").Return(repository.URLEntity{
+				ID:          "123",
+				OriginalURL: "http://yandex.ru",
+				UserID:      userID,
+				CreatedAt:   created,
+				UpdatedAt:   created.Add(time.Hour),
+			}, nil).Once()
+		})
+
+		It("should return updated url", func() {
+			status, body := patch("123", `{"url": "http://yandex.ru"}`)
+			Expect(status).To(Equal(http.StatusOK))
+			Expect(body).To(MatchJSON(`{
+"short_url": "http://localhost:8080/123",
+"original_url": "http://yandex.ru",
+"created_at": "2022-01-01T00:00:00Z",
+"updated_at": "2022-01-01T01:00:00Z"
+}`))
+			urlRepositoryMock.AssertExpectations(GinkgoT())
+		})
+	})
+
+	When("new url is not in canonical form", func() {
+		BeforeEach(func() {
+			urlRepositoryMock.On("UpdateOriginalURL", mock.Anything, userID, "123", "http://yandex.ru/a%20b").Return(repository.URLEntity{
+				ID:          "123",
+				OriginalURL: "http://yandex.ru/a%20b",
+				UserID:      userID,
+			}, nil).Once()
+		})
+
+		It("should store url in the same form as shortening does", func() {
+			status, _ := patch("123", `{"url": "http://yandex.ru/a b"}`)
+			Expect(status).To(Equal(http.StatusOK))
+			urlRepositoryMock.AssertExpectations(GinkgoT())
+		})
+	})
+
+	When("new url is already shortened", func() {
+		BeforeEach(func() {
+			urlRepositoryMock.On("UpdateOriginalURL", mock.Anything, userID, "123", "http://yandex.ru").
+				Return(repository.URLEntity{}, repository.NewErrURLExists("456")).Once()
+		})
+
+		It("should respond 409 with existing short url", func() {
+			status, body := patch("123", `{"url": "http://yandex.ru"}`)
+			Expect(status).To(Equal(http.StatusConflict))
+			Expect(body).To(MatchJSON(`{"result": "http://localhost:8080/456"}`))
+		})
+	})
+
+	When("url is not found or belongs to another user", func() {
+		BeforeEach(func() {
+			urlRepositoryMock.On("UpdateOriginalURL", mock.Anything, userID, "123", "http://yandex.ru").
+				Return(repository.URLEntity{}, repository.ErrURLNotFound).Once()
+		})
+
+		It("should respond 404", func() {
+			status, _ := patch("123", `{"url": "http://yandex.ru"}`)
+			Expect(status).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	When("new url is invalid", func() {
+		It("should respond 400 without touching repository", func() {
+			status, _ := patch("123", `{"url": "yandex"}`)
+			Expect(status).To(Equal(http.StatusBadRequest))
+			urlRepositoryMock.AssertNotCalled(GinkgoT(), "UpdateOriginalURL", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		})
+	})
+})
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"github.com/rs/zerolog/log"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/repository"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/shortener"
+)
+
+// generateURLID генерирует идентификатор ссылки для попытки attempt (начиная с 0). Длина идентификатора - см. shortener.URLIDLength
+func (s *Service) generateURLID(ctx context.Context, originalURL string, attempt int) (string, error) {
+	length := shortener.URLIDLength(s.IDGenerator, s.Config().ShortURLIdentifierLength, attempt)
+	return s.IDGenerator.GenerateURLID(ctx, originalURL, length)
+}
+
+// normalizeURL возвращает ссылку в том виде, в котором она сохраняется: канонический вид, если идентификатор от него зависит (см. shortener.URLNormalizer)
+func (s *Service) normalizeURL(originalURL string) string {
+	if normalizer, ok := s.IDGenerator.(shortener.URLNormalizer); ok {
+		return normalizer.NormalizeURL(originalURL)
+	}
+	return originalURL
+}
+
+func (s *Service) maxShortenAttempts() int {
+	if s.Config().ShortenMaxAttempts < 1 {
+		return 1
+	}
+	return s.Config().ShortenMaxAttempts
+}
+
+// storeWithGeneratedID сохраняет ссылку со сгенерированным идентификатором. Если идентификатор оказался занят - генерирует новый,
+// но не более ShortenMaxAttempts попыток. Возвращает идентификатор, с которым ссылка сохранена
+func (s *Service) storeWithGeneratedID(ctx context.Context, urlEntity repository.URLEntity) (string, error) {
+	var err error
+	for attempt := 0; attempt < s.maxShortenAttempts(); attempt++ {
+		if urlEntity.ID, err = s.generateURLID(ctx, urlEntity.OriginalURL, attempt); err != nil {
+			return "", err
+		}
+		err = s.Repository.Store(ctx, urlEntity)
+		var errIDConflict *repository.ErrURLIDConflict
+		if !errors.As(err, &errIDConflict) {
+			return urlEntity.ID, err
+		}
+		log.Warn().Err(err).Int("attempt", attempt+1).Msg("generated url id collision")
+	}
+	return "", err
+}
+
+// batchIDRegenerator возвращает функцию выдачи нового идентификатора при коллизиях в пакетном сохранении.
+// Пользовательские идентификаторы (aliases) не перегенерируются
+func (s *Service) batchIDRegenerator(aliases map[string]struct{}) repository.IDRegenerator {
+	return func(ctx context.Context, entity repository.URLEntity, attempt int) (string, error) {
+		_, isAlias := aliases[entity.ID]
+		if isAlias || attempt >= s.maxShortenAttempts() {
+			return "", repository.NewErrURLIDConflict(entity.ID)
+		}
+		log.Warn().Str("id", entity.ID).Int("attempt", attempt).Msg("generated url id collision in batch")
+		return s.generateURLID(ctx, entity.OriginalURL, attempt)
+	}
+}
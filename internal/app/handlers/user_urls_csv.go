@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/middlewares/cookieauth"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const csvContentType = "text/csv"
+
+// колонки CSV импорта ссылок. Обязательна только первая, заголовок необязателен
+var csvImportHeader = []string{"original_url", "alias", "correlation_id"}
+
+var csvImportResultHeader = []string{"correlation_id", "original_url", "short_url", "status", "error"}
+
+var csvExportHeader = []string{"short_url", "original_url", "deleted"}
+
+// ImportURLsCSVHandler сокращает ссылки из CSV (original_url, alias, correlation_id).
+// Ссылки обрабатываются потоково, как NDJSON в /api/shorten/batch: результат по каждой строке отправляется строкой CSV
+// (correlation_id, original_url, short_url, status, error) сразу после сохранения ее части списка, код ответа всегда 200.
+// Content-Type запроса должен быть text/csv: только для него включается одновременное чтение запроса и запись ответа
+func (s *Service) ImportURLsCSVHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != csvContentType {
+			http.Error(w, "Content-Type must be text/csv", http.StatusUnsupportedMediaType)
+			return
+		}
+		userID, err := cookieauth.FromContext(r.Context())
+		if err != nil {
+			log.Info().Err(err).Msg("unauthorized")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		resultWriter := csv.NewWriter(w)
+		flusher, _ := w.(http.Flusher)
+		started := false
+		start := func() error {
+			if started {
+				return nil
+			}
+			started = true
+			w.Header().Set("Content-Type", csvContentType+"; charset=utf-8")
+			w.WriteHeader(http.StatusOK)
+			return resultWriter.Write(csvImportResultHeader)
+		}
+		shortener := s.newBatchStreamShortener(userID, func(req batchShortenRequest, results []batchShortenResponseEntity) error {
+			if err := start(); err != nil {
+				return err
+			}
+			for idx, item := range results {
+				row := []string{item.CorrelationID, req[idx].OriginalURL, item.ShortURL, item.Status, item.Error}
+				if err := resultWriter.Write(row); err != nil {
+					return err
+				}
+			}
+			resultWriter.Flush()
+			if flusher != nil {
+				flusher.Flush()
+			}
+			return resultWriter.Error()
+		})
+
+		err = s.shortenCSV(r, shortener)
+		if err == nil {
+			err = shortener.Flush(r.Context())
+		}
+		if err == nil {
+			// пустой файл - отвечаем только заголовком
+			err = start()
+			resultWriter.Flush()
+		}
+		if err != nil {
+			log.Error().Err(err).Int("received", shortener.Received()).Msg("error while importing csv")
+			if !started {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			// код ответа уже отправлен, сообщаем об ошибке последней строкой
+			if err = resultWriter.Write([]string{"", "", "", batchItemError, "internal server error"}); err != nil {
+				log.Error().Err(err).Msg("write response failed")
+			}
+			resultWriter.Flush()
+		}
+	}
+}
+
+func (s *Service) shortenCSV(r *http.Request, shortener *batchStreamShortener) error {
+	reader := csv.NewReader(r.Body)
+	// таблицы часто выгружаются с разным количеством колонок в строках и "неправильными" кавычками
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+	for rowNum := 1; ; rowNum++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			log.Info().Err(err).Int("row", rowNum).Msg("invalid csv row")
+			if err = shortener.Reject(r.Context(), "", fmt.Errorf("invalid csv on line %d", parseErr.StartLine)); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if rowNum == 1 && isCSVImportHeader(record) {
+			continue
+		}
+		if err = shortener.Add(r.Context(), csvRecordToRequestEntity(record)); err != nil {
+			return err
+		}
+	}
+}
+
+func isCSVImportHeader(record []string) bool {
+	return strings.EqualFold(strings.TrimSpace(record[0]), csvImportHeader[0])
+}
+
+func csvRecordToRequestEntity(record []string) batchShortenRequestEntity {
+	field := func(idx int) string {
+		if idx < len(record) {
+			return strings.TrimSpace(record[idx])
+		}
+		return ""
+	}
+	return batchShortenRequestEntity{
+		OriginalURL:   field(0),
+		Alias:         field(1),
+		CorrelationID: field(2),
+	}
+}
+
+// ExportURLsHandler выгружает ссылки пользователя. Поддерживается только format=csv (он же по умолчанию)
+func (s *Service) ExportURLsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := cookieauth.FromContext(r.Context())
+		if err != nil {
+			log.Info().Err(err).Msg("unauthorized")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if format := r.URL.Query().Get("format"); format != "" && format != "csv" {
+			http.Error(w, fmt.Sprintf("Unsupported export format %s", format), http.StatusBadRequest)
+			return
+		}
+
+		urlEntities, err := s.Repository.LoadByUserID(r.Context(), userID)
+		if err != nil {
+			log.Error().Err(err).Msg("error while getting links from repository")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", csvContentType+"; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="urls.csv"`)
+		w.WriteHeader(http.StatusOK)
+		exportWriter := csv.NewWriter(w)
+		if err = exportWriter.Write(csvExportHeader); err != nil {
+			log.Error().Err(err).Msg("write response failed")
+			return
+		}
+		baseURL := s.Config().BaseURL
+		for _, entity := range urlEntities {
+			row := []string{fmt.Sprintf("%s/%s", baseURL, entity.ID), entity.OriginalURL, strconv.FormatBool(entity.Deleted)}
+			if err = exportWriter.Write(row); err != nil {
+				log.Error().Err(err).Msg("write response failed")
+				return
+			}
+		}
+		exportWriter.Flush()
+		if err = exportWriter.Error(); err != nil {
+			log.Error().Err(err).Msg("write response failed")
+		}
+	}
+}
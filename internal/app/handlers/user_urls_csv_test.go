@@ -0,0 +1,122 @@
+package handlers_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/config"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/handlers"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/repository"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/repository/mocks"
+	shortenerMocks "github.com/thorgnir-go-study/go-musthave-shortener/internal/app/shortener/mocks"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+var _ = Describe("UserURLsCSV", func() {
+	var ts *httptest.Server
+	var urlRepositoryMock *mocks.URLRepository
+	var idGeneratorMock *shortenerMocks.URLIDGenerator
+	var cookie *http.Cookie
+	var userID string
+
+	BeforeEach(func() {
+		urlRepositoryMock = new(mocks.URLRepository)
+		idGeneratorMock = new(shortenerMocks.URLIDGenerator)
+		cfg := config.Config{
+			BaseURL:            "http://localhost:8080",
+			ShortenBatchSize:   100,
+			ShortenMaxAttempts: 3,
+		}
+
+		service := handlers.NewService(urlRepositoryMock, idGeneratorMock, cfg)
+		r := handlers.NewRouter(service)
+		ts = httptest.NewServer(r)
+
+		urlRepositoryMock.On("LoadByUserID", mock.Anything, mock.Anything).Return([]repository.URLEntity{}, nil).Once()
+		res := testGetList(ts, nil)
+		cookie = res.Cookies()[0]
+		userID = strings.Split(cookie.Value, ":")[0]
+	})
+	AfterEach(func() {
+		ts.Close()
+	})
+
+	importCSV := func(contentType string, body string) *http.Response {
+		req, err := http.NewRequest("POST", ts.URL+"/api/user/urls/import", strings.NewReader(body))
+		Expect(err).NotTo(HaveOccurred())
+		req.Header.Set("Content-Type", contentType)
+		req.AddCookie(cookie)
+		res, err := http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		return res
+	}
+
+	When("csv is imported", func() {
+		BeforeEach(func() {
+			idGeneratorMock.On("GenerateURLID", mock.Anything, "http://google.com", mock.Anything).Return("shortGoogle", nil).Once()
+			urlRepositoryMock.On("StoreBatch", mock.Anything, mock.MatchedBy(func(b []repository.URLEntity) bool {
+				return len(b) == 2 && b[0].ID == "shortGoogle" && b[1].ID == "yandex" && b[1].UserID == userID
+			})).Return([]error{nil, repository.NewErrURLIDConflict("yandex")}, nil).Once()
+		})
+
+		It("should shorten urls and respond with results", func() {
+			res := importCSV("text/csv", `original_url,alias,correlation_id
+http://google.com,,1
+http://yandex.ru,yandex,2
+not an url,,3
+`)
+			defer res.Body.Close()
+			Expect(res.StatusCode).To(Equal(http.StatusOK))
+			Expect(res.Header.Get("Content-Type")).To(Equal("text/csv; charset=utf-8"))
+			body, err := io.ReadAll(res.Body)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(body)).To(Equal(`correlation_id,original_url,short_url,status,error
+1,http://google.com,http://localhost:8080/shortGoogle,created,
+2,http://yandex.ru,,conflict,alias yandex is already taken
+3,not an url,,invalid,invalid url not an url
+`))
+			urlRepositoryMock.AssertExpectations(GinkgoT())
+		})
+	})
+
+	When("content type is not csv", func() {
+		It("should respond 415", func() {
+			res := importCSV("application/json", "http://google.com")
+			defer res.Body.Close()
+			Expect(res.StatusCode).To(Equal(http.StatusUnsupportedMediaType))
+		})
+	})
+
+	When("urls are exported", func() {
+		BeforeEach(func() {
+			urlRepositoryMock.On("LoadByUserID", mock.Anything, userID).Return([]repository.URLEntity{
+				{ID: "123", OriginalURL: "http://google.com", UserID: userID},
+				{ID: "456", OriginalURL: "http://yandex.ru/?q=a,b", UserID: userID, Deleted: true},
+			}, nil).Once()
+		})
+
+		It("should respond with csv", func() {
+			res := testRequest(ts, "GET", "/api/user/urls/export?format=csv", []*http.Cookie{cookie}, nil)
+			defer res.Body.Close()
+			Expect(res.StatusCode).To(Equal(http.StatusOK))
+			Expect(res.Header.Get("Content-Type")).To(Equal("text/csv; charset=utf-8"))
+			body, err := io.ReadAll(res.Body)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(body)).To(Equal(`short_url,original_url,deleted
+http://localhost:8080/123,http://google.com,false
+http://localhost:8080/456,"http://yandex.ru/?q=a,b",true
+`))
+		})
+	})
+
+	When("export format is not supported", func() {
+		It("should respond 400", func() {
+			res := testRequest(ts, "GET", "/api/user/urls/export?format=xlsx", []*http.Cookie{cookie}, nil)
+			defer res.Body.Close()
+			Expect(res.StatusCode).To(Equal(http.StatusBadRequest))
+		})
+	})
+})
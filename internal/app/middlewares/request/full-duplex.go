@@ -0,0 +1,49 @@
+package request
+
+import (
+	"mime"
+	"net/http"
+)
+
+type fullDuplexEnabler interface {
+	EnableFullDuplex() error
+}
+
+type responseWriterUnwrapper interface {
+	Unwrap() http.ResponseWriter
+}
+
+// FullDuplex позволяет обработчикам запросов с указанными Content-Type писать ответ, не дочитав тело запроса.
+// По умолчанию HTTP/1.x сервер закрывает тело запроса, как только начинается ответ.
+// Должен стоять до middleware, оборачивающих ResponseWriter без метода Unwrap (например, middleware.Compress).
+// Поддерживается сервером начиная с go 1.21, на более старых версиях запросы обрабатываются как обычно
+func FullDuplex(contentTypes ...string) func(next http.Handler) http.Handler {
+	allowed := make(map[string]struct{}, len(contentTypes))
+	for _, contentType := range contentTypes {
+		allowed[contentType] = struct{}{}
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if _, ok := allowed[mediaType]; ok && err == nil {
+				enableFullDuplex(w)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func enableFullDuplex(w http.ResponseWriter) {
+	for {
+		if enabler, ok := w.(fullDuplexEnabler); ok {
+			// ошибка означает, что протокол не требует (HTTP/2) или не поддерживает этот режим, обрабатываем запрос как обычно
+			_ = enabler.EnableFullDuplex()
+			return
+		}
+		unwrapper, ok := w.(responseWriterUnwrapper)
+		if !ok {
+			return
+		}
+		w = unwrapper.Unwrap()
+	}
+}
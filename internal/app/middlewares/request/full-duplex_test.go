@@ -0,0 +1,52 @@
+package request
+
+import (
+	"bufio"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFullDuplex(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(middleware.Logger)
+	r.Use(FullDuplex("application/x-ndjson"))
+	r.Use(middleware.Compress(5))
+	r.Post("/echo", echoLinesHandler)
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	// тело длиннее буфера, который сервер читает до вызова обработчика
+	body := strings.Repeat(strings.Repeat("x", 1023)+"\n", 256)
+	req, err := http.NewRequest("POST", ts.URL+"/echo", strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+	respBody, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, body, string(respBody))
+}
+
+// echoLinesHandler отвечает каждой строкой тела запроса сразу после ее прочтения
+func echoLinesHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	w.Header().Set("Content-Type", "text/plain")
+	scanner := bufio.NewScanner(r.Body)
+	for scanner.Scan() {
+		if _, err := w.Write([]byte(scanner.Text() + "\n")); err != nil {
+			return
+		}
+		w.(http.Flusher).Flush()
+	}
+}
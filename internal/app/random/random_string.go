@@ -1,6 +1,8 @@
 package random
 
 import (
+	cryptoRand "crypto/rand"
+	"math/big"
 	"math/rand"
 	"time"
 )
@@ -16,3 +18,18 @@ func String(n int) string {
 	}
 	return string(b)
 }
+
+// SecureString генерирует строку длины n из символов alphabet с помощью криптографически стойкого генератора
+func SecureString(n int, alphabet string) (string, error) {
+	max := big.NewInt(int64(len(alphabet)))
+	b := make([]byte, n)
+	for i := range b {
+		// rand.Int выдает равномерно распределенные значения, в отличие от взятия остатка от деления случайного числа
+		idx, err := cryptoRand.Int(cryptoRand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = alphabet[idx.Int64()]
+	}
+	return string(b), nil
+}
@@ -1,28 +1,48 @@
 package repository
 
-import "context"
+import (
+	"context"
+	"errors"
+)
 
 //type BatchURLEntityWriter interface {
 //	Add(ctx context.Context, e URLEntity) error
 //	Flush(ctx context.Context) error
 //}
 
+// IDRegenerator возвращает новый идентификатор для ссылки, идентификатор которой оказался занят.
+// attempt - номер повторной попытки для этой ссылки, начиная с 1.
+// Если новый идентификатор выдать нельзя - возвращает ErrURLIDConflict, любая другая ошибка прерывает сохранение пакета
+type IDRegenerator func(ctx context.Context, entity URLEntity, attempt int) (string, error)
+
+// BatchItem ссылка, сохраняемая в составе пакета, и результат ее сохранения
+type BatchItem struct {
+	Entity URLEntity
+	// Err nil, если ссылка сохранена, иначе ErrURLExists или ErrURLIDConflict
+	Err error
+}
+
 type BatchURLEntityStoreService struct {
-	batchSize  int
-	buffer     []URLEntity
-	repository URLRepository
+	batchSize    int
+	buffer       []*BatchItem
+	repository   URLRepository
+	regenerateID IDRegenerator
 }
 
-func NewBatchURLEntityStoreService(batchSize int, repository URLRepository) *BatchURLEntityStoreService {
+// NewBatchURLEntityStoreService создает сервис пакетного сохранения ссылок.
+// Если regenerateID не nil, при коллизии идентификаторов ссылке выдается новый идентификатор и она сохраняется повторно.
+// Итоговый идентификатор и результат сохранения записываются в BatchItem, переданный в Add
+func NewBatchURLEntityStoreService(batchSize int, repository URLRepository, regenerateID IDRegenerator) *BatchURLEntityStoreService {
 	return &BatchURLEntityStoreService{
-		batchSize:  batchSize,
-		buffer:     make([]URLEntity, 0, batchSize),
-		repository: repository,
+		batchSize:    batchSize,
+		buffer:       make([]*BatchItem, 0, batchSize),
+		repository:   repository,
+		regenerateID: regenerateID,
 	}
 }
 
-func (s *BatchURLEntityStoreService) Add(ctx context.Context, e URLEntity) error {
-	s.buffer = append(s.buffer, e)
+func (s *BatchURLEntityStoreService) Add(ctx context.Context, item *BatchItem) error {
+	s.buffer = append(s.buffer, item)
 	if cap(s.buffer) == len(s.buffer) {
 		if err := s.Flush(ctx); err != nil {
 			return err
@@ -31,14 +51,61 @@ func (s *BatchURLEntityStoreService) Add(ctx context.Context, e URLEntity) error
 	return nil
 }
 
+// Flush сохраняет накопленные ссылки. Ошибка возвращается только если не удалось сохранить пакет целиком,
+// результаты сохранения отдельных ссылок записываются в их BatchItem
 func (s *BatchURLEntityStoreService) Flush(ctx context.Context) error {
 	if len(s.buffer) == 0 {
 		return nil
 	}
-	err := s.repository.StoreBatch(ctx, s.buffer)
-	if err != nil {
-		return err
+	pending := s.buffer
+	attempts := make(map[*BatchItem]int)
+	for len(pending) > 0 {
+		itemErrs, err := s.repository.StoreBatch(ctx, entities(pending))
+		if err != nil {
+			return err
+		}
+		var retry []*BatchItem
+		for idx, item := range pending {
+			item.Err = itemErrs[idx]
+			regenerated, err := s.regenerateConflictingID(ctx, item, attempts)
+			if err != nil {
+				return err
+			}
+			if regenerated {
+				retry = append(retry, item)
+			}
+		}
+		pending = retry
 	}
 	s.buffer = s.buffer[:0]
 	return nil
 }
+
+// regenerateConflictingID выдает новый идентификатор ссылке, если ее сохранение не удалось из-за коллизии.
+// Возвращает true, если ссылку нужно сохранить повторно
+func (s *BatchURLEntityStoreService) regenerateConflictingID(ctx context.Context, item *BatchItem, attempts map[*BatchItem]int) (bool, error) {
+	var errIDConflict *ErrURLIDConflict
+	if s.regenerateID == nil || !errors.As(item.Err, &errIDConflict) {
+		return false, nil
+	}
+	attempts[item]++
+	id, err := s.regenerateID(ctx, item.Entity, attempts[item])
+	if errors.As(err, &errIDConflict) {
+		item.Err = err
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	item.Entity.ID = id
+	item.Err = nil
+	return true, nil
+}
+
+func entities(items []*BatchItem) []URLEntity {
+	entities := make([]URLEntity, len(items))
+	for idx, item := range items {
+		entities[idx] = item.Entity
+	}
+	return entities
+}
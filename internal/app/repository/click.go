@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// Click переход по сокращенной ссылке
+type Click struct {
+	URLID     string    `db:"url_id"`
+	ClickedAt time.Time `db:"clicked_at"`
+	Referrer  string    `db:"referrer"`
+	UserAgent string    `db:"user_agent"`
+}
+
+// DailyClicks количество переходов по ссылке за сутки (UTC)
+type DailyClicks struct {
+	Date  time.Time `db:"day"`
+	Count int       `db:"clicks"`
+}
+
+// URLStats статистика переходов по ссылке
+type URLStats struct {
+	Total int
+	Daily []DailyClicks
+}
+
+// ClickRepository представляет интерфейс хранилища статистики переходов по ссылкам
+type ClickRepository interface {
+	// RecordClick сохраняет информацию о переходе по ссылке
+	RecordClick(ctx context.Context, click Click) error
+	// LoadStats возвращает статистику переходов по ссылке с идентификатором urlID
+	LoadStats(ctx context.Context, urlID string) (URLStats, error)
+}
+
+// clickStatsDays за сколько последних дней хранятся переходы по дням в памяти
+const clickStatsDays = 366
+
+// clickCounter счетчики переходов по ссылке: общий и по дням. Отдельные переходы не хранятся,
+// а дни старше clickStatsDays от последнего перехода отбрасываются, чтобы статистика не росла без ограничений
+type clickCounter struct {
+	total int
+	byDay map[time.Time]int
+}
+
+func newClickCounter() *clickCounter {
+	return &clickCounter{byDay: make(map[time.Time]int)}
+}
+
+func (c *clickCounter) add(click Click) {
+	c.addDay(truncateToDay(click.ClickedAt), 1)
+}
+
+// addDay добавляет count переходов за день day
+func (c *clickCounter) addDay(day time.Time, count int) {
+	c.total += count
+	c.byDay[day] += count
+	oldest := day.AddDate(0, 0, -clickStatsDays)
+	for d := range c.byDay {
+		if d.Before(oldest) {
+			delete(c.byDay, d)
+		}
+	}
+}
+
+func (c *clickCounter) stats() URLStats {
+	stats := URLStats{
+		Total: c.total,
+		Daily: make([]DailyClicks, 0, len(c.byDay)),
+	}
+	for day, count := range c.byDay {
+		stats.Daily = append(stats.Daily, DailyClicks{Date: day, Count: count})
+	}
+	sort.Slice(stats.Daily, func(i, j int) bool {
+		return stats.Daily[i].Date.Before(stats.Daily[j].Date)
+	})
+	return stats
+}
+
+func truncateToDay(t time.Time) time.Time {
+	year, month, day := t.UTC().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
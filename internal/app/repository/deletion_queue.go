@@ -0,0 +1,28 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+// DeletionRequest запрос пользователя на удаление ссылок, ожидающий выполнения
+type DeletionRequest struct {
+	ID        string
+	UserID    string
+	URLIDs    []string
+	CreatedAt time.Time
+}
+
+// DeletionQueueRepository представляет интерфейс хранимой очереди запросов на удаление ссылок.
+// Запрос остается в очереди, пока не будет выполнен, поэтому переживает перезапуск сервиса
+type DeletionQueueRepository interface {
+	// EnqueueDeletion сохраняет запрос на удаление
+	EnqueueDeletion(ctx context.Context, req DeletionRequest) error
+	// PendingDeletions возвращает невыполненные запросы в порядке поступления
+	PendingDeletions(ctx context.Context) ([]DeletionRequest, error)
+	// CompleteDeletions убирает выполненные запросы из очереди. Неизвестные идентификаторы пропускаются
+	CompleteDeletions(ctx context.Context, ids []string) error
+	// CancelDeletions убирает ссылки urlIDs из невыполненных запросов пользователя userID (например, при восстановлении ссылок).
+	// Запросы, в которых не осталось ссылок, остаются в очереди до выполнения
+	CancelDeletions(ctx context.Context, userID string, urlIDs []string) error
+}
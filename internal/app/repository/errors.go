@@ -8,6 +8,9 @@ import (
 // ErrURLNotFound ошибка "ссылка не найдена в хранилище"
 var ErrURLNotFound = errors.New("url not found in repository")
 
+// ErrInvalidCursor ошибка "некорректный курсор постраничной выборки"
+var ErrInvalidCursor = errors.New("invalid page cursor")
+
 // ErrURLExists ошибка "оригинальная ссылка уже существует в хранилище"
 type ErrURLExists struct {
 	ID  string
@@ -25,3 +28,21 @@ func (e *ErrURLExists) Error() string {
 func (e *ErrURLExists) Unwrap() error {
 	return e.Err
 }
+
+// ErrURLIDConflict ошибка "идентификатор сокращенной ссылки уже занят другой ссылкой"
+type ErrURLIDConflict struct {
+	ID  string
+	Err error
+}
+
+func NewErrURLIDConflict(id string) *ErrURLIDConflict {
+	return &ErrURLIDConflict{ID: id}
+}
+
+func (e *ErrURLIDConflict) Error() string {
+	return fmt.Sprintf("short url id is already taken. short url id: %s", e.ID)
+}
+
+func (e *ErrURLIDConflict) Unwrap() error {
+	return e.Err
+}
@@ -2,19 +2,56 @@ package repository
 
 import (
 	"bufio"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
+// storedURL ссылка вместе с порядковым номером создания, в таком виде ссылки записываются в файл.
+// Номер сохраняется, чтобы курсоры страниц (см. LoadPageByUserID) оставались действительными после перезапуска и очистки файла
+type storedURL struct {
+	URLEntity
+	// position порядковый номер создания ссылки. 0 - в строке файла номера нет (записана до появления номеров)
+	position uint64
+}
+
 type inMemoryRepoFilePersister interface {
-	Store(entity URLEntity) error
-	Load(dest map[string]URLEntity) error
+	Store(url storedURL) error
+	// Load возвращает записи файла в порядке записи. Изменения ссылки записываются отдельными строками после ее создания
+	Load() ([]storedURL, error)
+	// Rewrite заменяет содержимое файла текущим состоянием хранилища, ссылки должны идти в порядке создания
+	Rewrite(urls []storedURL) error
+	// StoreSequence сохраняет значение счетчика идентификаторов
+	StoreSequence(value uint64) error
+	// LoadSequence возвращает сохраненное значение счетчика идентификаторов, 0 если оно не сохранялось
+	LoadSequence() (uint64, error)
+	// StoreDeletion дописывает в журнал очереди запрос на удаление ссылок
+	StoreDeletion(req DeletionRequest) error
+	// CompleteDeletions дописывает в журнал очереди отметки о выполнении запросов
+	CompleteDeletions(ids []string) error
+	// LoadDeletions возвращает невыполненные запросы из журнала очереди в порядке поступления
+	LoadDeletions() ([]DeletionRequest, error)
+	// RewriteDeletions заменяет журнал очереди невыполненными запросами
+	RewriteDeletions(pending []DeletionRequest) error
+	// StoreClick дописывает в журнал статистики переход по ссылке
+	StoreClick(click Click) error
+	// LoadClicks возвращает счетчики переходов из журнала статистики
+	LoadClicks() (map[string]*clickCounter, error)
+	// RewriteClicks заменяет журнал статистики счетчиками clicks
+	RewriteClicks(clicks map[string]*clickCounter) error
+	// Sync сбрасывает записанное на диск
+	Sync() error
 }
 
+// clickDayLayout формат дня в журнале статистики переходов
+const clickDayLayout = "2006-01-02"
+
 type inMemoryRepoFilePersisterPlain struct {
 	mx       sync.Mutex
 	filename string
@@ -26,7 +63,7 @@ func createNewInMemoryRepoFilePersisterPlain(filename string) *inMemoryRepoFileP
 	}
 }
 
-func (p *inMemoryRepoFilePersisterPlain) Store(entity URLEntity) error {
+func (p *inMemoryRepoFilePersisterPlain) Store(url storedURL) error {
 	// тут возможны разные подходы, в зависимости от предполагаемой нагрузки
 	// если предположить, что запись будет частой, то имеет смысл держать файл открытым и в структуру добавить writer
 	// текущая реализация для варианта "пишем редко"
@@ -39,8 +76,7 @@ func (p *inMemoryRepoFilePersisterPlain) Store(entity URLEntity) error {
 	defer file.Close()
 
 	w := bufio.NewWriter(file)
-	_, err = fmt.Fprintf(w, "%s\t%s\t%s\t%t\n", entity.ID, entity.UserID, entity.OriginalURL, entity.Deleted)
-	if err != nil {
+	if err = writeURL(w, url); err != nil {
 		return err
 	}
 	err = w.Flush()
@@ -50,39 +86,380 @@ func (p *inMemoryRepoFilePersisterPlain) Store(entity URLEntity) error {
 	return nil
 }
 
-func (p *inMemoryRepoFilePersisterPlain) Load(dest map[string]URLEntity) error {
+func (p *inMemoryRepoFilePersisterPlain) Rewrite(urls []storedURL) error {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	return replaceFile(p.filename, func(w io.Writer) error {
+		for _, url := range urls {
+			if err := writeURL(w, url); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// sequenceFilename счетчик хранится в отдельном файле рядом с основным, так как основной файл - журнал ссылок
+func (p *inMemoryRepoFilePersisterPlain) sequenceFilename() string {
+	return p.filename + ".seq"
+}
+
+func (p *inMemoryRepoFilePersisterPlain) StoreSequence(value uint64) error {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	return replaceFile(p.sequenceFilename(), func(w io.Writer) error {
+		_, err := fmt.Fprintf(w, "%d\n", value)
+		return err
+	})
+}
+
+func (p *inMemoryRepoFilePersisterPlain) LoadSequence() (uint64, error) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	data, err := os.ReadFile(p.sequenceFilename())
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	value, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("error while parsing sequence value; %w", err)
+	}
+	return value, nil
+}
+
+// deletionsFilename очередь запросов на удаление - отдельный журнал рядом с основным файлом.
+// Строка "+" - запрос (идентификатор, пользователь, время, идентификаторы ссылок в json), строка "-" - отметка о выполнении запроса
+func (p *inMemoryRepoFilePersisterPlain) deletionsFilename() string {
+	return p.filename + ".deletions"
+}
+
+func (p *inMemoryRepoFilePersisterPlain) StoreDeletion(req DeletionRequest) error {
+	return p.appendDeletions(func(w io.Writer) error {
+		return writeDeletion(w, req)
+	})
+}
+
+func (p *inMemoryRepoFilePersisterPlain) CompleteDeletions(ids []string) error {
+	return p.appendDeletions(func(w io.Writer) error {
+		for _, id := range ids {
+			if _, err := fmt.Fprintf(w, "-\t%s\n", id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (p *inMemoryRepoFilePersisterPlain) appendDeletions(write func(w io.Writer) error) error {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	file, err := os.OpenFile(p.deletionsFilename(), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	if err = write(w); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func (p *inMemoryRepoFilePersisterPlain) RewriteDeletions(pending []DeletionRequest) error {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	return replaceFile(p.deletionsFilename(), func(w io.Writer) error {
+		for _, req := range pending {
+			if err := writeDeletion(w, req); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (p *inMemoryRepoFilePersisterPlain) LoadDeletions() ([]DeletionRequest, error) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	file, err := os.Open(p.deletionsFilename())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var pending []DeletionRequest
+	completed := make(map[string]struct{})
+	s := bufio.NewScanner(file)
+	for s.Scan() {
+		splittedData := strings.Split(s.Text(), "\t")
+		switch {
+		case len(splittedData) == 2 && splittedData[0] == "-":
+			completed[splittedData[1]] = struct{}{}
+		case len(splittedData) == 5 && splittedData[0] == "+":
+			req := DeletionRequest{ID: splittedData[1], UserID: splittedData[2]}
+			if req.CreatedAt, err = time.Parse(time.RFC3339Nano, splittedData[3]); err != nil {
+				return nil, fmt.Errorf("error while parsing deletion request time; %w", err)
+			}
+			if err = json.Unmarshal([]byte(splittedData[4]), &req.URLIDs); err != nil {
+				return nil, fmt.Errorf("error while parsing deletion request urls; %w", err)
+			}
+			pending = append(pending, req)
+		default:
+			return nil, errors.New("invalid string in deletion queue file")
+		}
+	}
+	if err = s.Err(); err != nil {
+		return nil, err
+	}
+
+	result := pending[:0]
+	for _, req := range pending {
+		if _, ok := completed[req.ID]; !ok {
+			result = append(result, req)
+		}
+	}
+	return result, nil
+}
+
+// clicksFilename статистика переходов - отдельный журнал рядом с основным файлом.
+// Строка - идентификатор ссылки, день (пустой - только в общий счетчик, для дней старше clickStatsDays) и количество переходов.
+// Переходы дописываются по одному, при загрузке журнал сворачивается в счетчики
+func (p *inMemoryRepoFilePersisterPlain) clicksFilename() string {
+	return p.filename + ".clicks"
+}
+
+func (p *inMemoryRepoFilePersisterPlain) StoreClick(click Click) error {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	file, err := os.OpenFile(p.clicksFilename(), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = fmt.Fprintf(file, "%s\t%s\t1\n", click.URLID, truncateToDay(click.ClickedAt).Format(clickDayLayout))
+	return err
+}
+
+func (p *inMemoryRepoFilePersisterPlain) RewriteClicks(clicks map[string]*clickCounter) error {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	return replaceFile(p.clicksFilename(), func(w io.Writer) error {
+		for urlID, counter := range clicks {
+			inDays := 0
+			for day, count := range counter.byDay {
+				inDays += count
+				if _, err := fmt.Fprintf(w, "%s\t%s\t%d\n", urlID, day.Format(clickDayLayout), count); err != nil {
+					return err
+				}
+			}
+			if rest := counter.total - inDays; rest > 0 {
+				if _, err := fmt.Fprintf(w, "%s\t\t%d\n", urlID, rest); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (p *inMemoryRepoFilePersisterPlain) LoadClicks() (map[string]*clickCounter, error) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	clicks := make(map[string]*clickCounter)
+	file, err := os.Open(p.clicksFilename())
+	if errors.Is(err, os.ErrNotExist) {
+		return clicks, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	s := bufio.NewScanner(file)
+	for s.Scan() {
+		splittedData := strings.Split(s.Text(), "\t")
+		if len(splittedData) != 3 {
+			return nil, errors.New("invalid string in clicks file")
+		}
+		count, err := strconv.Atoi(splittedData[2])
+		if err != nil {
+			return nil, fmt.Errorf("error while parsing clicks count; %w", err)
+		}
+		counter, ok := clicks[splittedData[0]]
+		if !ok {
+			counter = newClickCounter()
+			clicks[splittedData[0]] = counter
+		}
+		if splittedData[1] == "" {
+			counter.total += count
+			continue
+		}
+		day, err := time.Parse(clickDayLayout, splittedData[1])
+		if err != nil {
+			return nil, fmt.Errorf("error while parsing clicks day; %w", err)
+		}
+		counter.addDay(day, count)
+	}
+	if err = s.Err(); err != nil {
+		return nil, err
+	}
+	return clicks, nil
+}
+
+// Sync файлы открываются на каждую запись и не буферизуются, но закрытие файла не гарантирует, что данные дошли до диска
+func (p *inMemoryRepoFilePersisterPlain) Sync() error {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	for _, filename := range []string{p.filename, p.sequenceFilename(), p.deletionsFilename(), p.clicksFilename()} {
+		if err := syncFile(filename); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func syncFile(filename string) error {
+	file, err := os.OpenFile(filename, os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (p *inMemoryRepoFilePersisterPlain) Load() ([]storedURL, error) {
 	p.mx.Lock()
 	defer p.mx.Unlock()
 	file, err := os.Open(p.filename)
 	// файла нет, выходим
 	if err != nil {
-		return nil
+		return nil, nil
 	}
 	defer file.Close()
 	s := bufio.NewScanner(file)
 
+	var urls []storedURL
 	for s.Scan() {
 		dataStr := s.Text()
 		splittedData := strings.Split(dataStr, "\t")
-		if len(splittedData) != 4 {
-			return errors.New("invalid string in url repository file")
+		// файлы, записанные до появления срока действия ссылок, содержат 4 поля, до появления времени создания и изменения - 5,
+		// до появления порядкового номера - 8
+		if len(splittedData) != 4 && len(splittedData) != 5 && len(splittedData) != 8 && len(splittedData) != 9 {
+			return nil, errors.New("invalid string in url repository file")
 		}
 
 		isDeleted, err := strconv.ParseBool(splittedData[3])
 		if err != nil {
-			return fmt.Errorf("error while parsing deleted flag; %w", err)
+			return nil, fmt.Errorf("error while parsing deleted flag; %w", err)
 		}
-		dest[splittedData[0]] = URLEntity{
+		entity := URLEntity{
 			ID:          splittedData[0],
 			OriginalURL: splittedData[2],
 			UserID:      splittedData[1],
 			Deleted:     isDeleted,
 		}
+		if len(splittedData) >= 5 {
+			if entity.ExpiresAt, err = parseOptionalTime(splittedData[4]); err != nil {
+				return nil, fmt.Errorf("error while parsing expiration time; %w", err)
+			}
+		}
+		if len(splittedData) >= 8 {
+			if entity.CreatedAt, err = time.Parse(time.RFC3339Nano, splittedData[5]); err != nil {
+				return nil, fmt.Errorf("error while parsing creation time; %w", err)
+			}
+			if entity.UpdatedAt, err = time.Parse(time.RFC3339Nano, splittedData[6]); err != nil {
+				return nil, fmt.Errorf("error while parsing modification time; %w", err)
+			}
+			if entity.DeletedAt, err = parseOptionalTime(splittedData[7]); err != nil {
+				return nil, fmt.Errorf("error while parsing deletion time; %w", err)
+			}
+		}
+		url := storedURL{URLEntity: entity}
+		if len(splittedData) == 9 {
+			if url.position, err = strconv.ParseUint(splittedData[8], 10, 64); err != nil {
+				return nil, fmt.Errorf("error while parsing position; %w", err)
+			}
+		}
+		urls = append(urls, url)
 	}
 
 	if err = s.Err(); err != nil {
+		return nil, err
+	}
+
+	return urls, nil
+}
+
+func writeURL(w io.Writer, url storedURL) error {
+	entity := url.URLEntity
+	_, err := fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%s\t%s\t%s\t%s\t%d\n",
+		entity.ID, entity.UserID, entity.OriginalURL, entity.Deleted, formatOptionalTime(entity.ExpiresAt),
+		entity.CreatedAt.Format(time.RFC3339Nano), entity.UpdatedAt.Format(time.RFC3339Nano), formatOptionalTime(entity.DeletedAt), url.position)
+	return err
+}
+
+func writeDeletion(w io.Writer, req DeletionRequest) error {
+	urlIDs, err := json.Marshal(req.URLIDs)
+	if err != nil {
 		return err
 	}
+	_, err = fmt.Fprintf(w, "+\t%s\t%s\t%s\t%s\n", req.ID, req.UserID, req.CreatedAt.Format(time.RFC3339Nano), urlIDs)
+	return err
+}
 
-	return nil
+// formatOptionalTime незаданное время записывается пустой строкой
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+func parseOptionalTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// replaceFile записывает содержимое во временный файл и подменяет им filename, чтобы при сбое посередине записи не потерять данные
+func replaceFile(filename string, write func(w io.Writer) error) error {
+	tmpFilename := filename + ".tmp"
+	file, err := os.OpenFile(tmpFilename, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	if err = write(w); err != nil {
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFilename, filename)
 }
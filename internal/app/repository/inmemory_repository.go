@@ -3,13 +3,38 @@ package repository
 import (
 	"context"
 	"github.com/rs/zerolog/log"
+	"sort"
 	"sync"
+	"time"
 )
 
 type inMemoryRepo struct {
-	mx        sync.RWMutex
-	m         map[string]URLEntity
+	mx sync.RWMutex
+	m  map[string]URLEntity
+	// byOriginalURL обратный индекс оригинальная ссылка -> идентификатор, аналог уникального индекса по original_url в БД.
+	// Ключ зависит от области уникальности, см. originalURLKey
+	byOriginalURL   map[string]string
+	uniquenessScope UniquenessScope
+	// positions порядковые номера создания ссылок, аналог id в БД. Сохраняются в файле, на них основаны курсоры страниц
+	positions    map[string]uint64
+	lastPosition uint64
+	// byUser идентификаторы ссылок пользователя в порядке создания
+	byUser    map[string][]string
 	persister inMemoryRepoFilePersister
+
+	// clicks счетчики переходов по ссылкам, под своим мьютексом, чтобы запись перехода не блокировала хранилище ссылок
+	clicksMx sync.RWMutex
+	clicks   map[string]*clickCounter
+
+	deletionsMx sync.Mutex
+	// deletions невыполненные запросы на удаление в порядке поступления
+	deletions []DeletionRequest
+
+	seqMx sync.Mutex
+	// seqLast последнее выданное значение счетчика
+	seqLast uint64
+	// seqReserved верхняя граница зарезервированных (записанных в файл) значений счетчика
+	seqReserved uint64
 }
 
 type InMemoryRepositoryOption func(*inMemoryRepo) error
@@ -17,7 +42,12 @@ type InMemoryRepositoryOption func(*inMemoryRepo) error
 // NewInMemoryRepository создает реализацию хранилища ссылок в памяти, на основе map
 func NewInMemoryRepository(opts ...InMemoryRepositoryOption) (*inMemoryRepo, error) {
 	storage := &inMemoryRepo{
-		m: make(map[string]URLEntity),
+		m:               make(map[string]URLEntity),
+		byOriginalURL:   make(map[string]string),
+		uniquenessScope: GlobalUniqueness,
+		positions:       make(map[string]uint64),
+		byUser:          make(map[string][]string),
+		clicks:          make(map[string]*clickCounter),
 	}
 
 	for _, opt := range opts {
@@ -27,30 +57,100 @@ func NewInMemoryRepository(opts ...InMemoryRepositoryOption) (*inMemoryRepo, err
 		}
 	}
 
+	// состояние восстанавливаем после применения всех опций, так как ключи индексов зависят от области уникальности
+	if storage.persister != nil {
+		urls, err := storage.persister.Load()
+		if err != nil {
+			return nil, err
+		}
+		// записи идут в порядке создания ссылок, последующие записи по той же ссылке - ее изменения
+		for _, url := range urls {
+			storage.putAt(url.URLEntity, url.position)
+		}
+		if err = storage.backfillDeletedAt(time.Now().UTC()); err != nil {
+			return nil, err
+		}
+		if err = storage.loadClicks(); err != nil {
+			return nil, err
+		}
+		if storage.deletions, err = storage.persister.LoadDeletions(); err != nil {
+			return nil, err
+		}
+	}
+
 	return storage, nil
 }
 
+// backfillDeletedAt проставляет время удаления now ссылкам, удаленным до появления времени удаления (строки файла без него),
+// чтобы срок хранения удаленных ссылок отсчитывался от момента загрузки. Файл перезаписывается, чтобы время не сдвигалось при каждом старте
+func (s *inMemoryRepo) backfillDeletedAt(now time.Time) error {
+	backfilled := false
+	for id, entity := range s.m {
+		if entity.Deleted && entity.DeletedAt == nil {
+			entity.DeletedAt = &now
+			s.m[id] = entity
+			backfilled = true
+		}
+	}
+	if !backfilled {
+		return nil
+	}
+	return s.persister.Rewrite(s.ordered())
+}
+
+// loadClicks восстанавливает счетчики переходов по сохраненным ссылкам и сворачивает журнал статистики,
+// чтобы он не рос от перезапуска к перезапуску. Переходы по окончательно удаленным ссылкам отбрасываются
+func (s *inMemoryRepo) loadClicks() error {
+	clicks, err := s.persister.LoadClicks()
+	if err != nil {
+		return err
+	}
+	if len(clicks) == 0 {
+		return nil
+	}
+	for urlID, counter := range clicks {
+		if _, ok := s.m[urlID]; ok {
+			s.clicks[urlID] = counter
+		}
+	}
+	return s.persister.RewriteClicks(s.clicks)
+}
+
+// WithUniquenessScope задает область уникальности оригинальных ссылок. По умолчанию - GlobalUniqueness
+func WithUniquenessScope(scope UniquenessScope) InMemoryRepositoryOption {
+	return func(storage *inMemoryRepo) error {
+		storage.uniquenessScope = scope
+		return nil
+	}
+}
+
 // WithFilePersistance позволяет сохранять в файле состояние хранилища, и при создании хранилища восстанавливать состояние из файла.
 func WithFilePersistance(filename string) InMemoryRepositoryOption {
 	return func(storage *inMemoryRepo) error {
-		persister := createNewInMemoryRepoFilePersisterPlain(filename)
-		storage.persister = persister
-		err := storage.persister.Load(storage.m)
-		if err != nil {
+		storage.persister = createNewInMemoryRepoFilePersisterPlain(filename)
+		var err error
+		// значения до зарезервированной границы могли быть выданы до перезапуска, продолжаем после нее
+		if storage.seqReserved, err = storage.persister.LoadSequence(); err != nil {
 			return err
 		}
+		storage.seqLast = storage.seqReserved
 		return nil
 	}
 }
 
 // Store implements URLRepository.Store
 func (s *inMemoryRepo) Store(_ context.Context, urlEntity URLEntity) error {
+	urlEntity = urlEntity.created(time.Now().UTC())
 	s.mx.Lock()
 	defer s.mx.Unlock()
-	// По заданию было добавить уникальный индекс по оригинальной ссылке только в хранилище БД
-	// Поэтому тут проверка уникальности нереализована.
-	// Можно реализовать, но будет крайне неэффективно при данной модели хранения - придется перебирать все записи
-	s.m[urlEntity.ID] = urlEntity
+	// проверки в том же порядке, что и в БД: сначала уникальность оригинальной ссылки, затем идентификатора
+	if err := s.checkOriginalURLAvailable(urlEntity); err != nil {
+		return err
+	}
+	if err := s.checkIDAvailable(urlEntity); err != nil {
+		return err
+	}
+	s.put(urlEntity)
 
 	// по поводу "задачи со звездочкой" (писать в файл через middleware)
 	// я не очень понял, как это можно тут реализовать малой кровью.
@@ -59,7 +159,7 @@ func (s *inMemoryRepo) Store(_ context.Context, urlEntity URLEntity) error {
 	// (добавление поддержки построения цепочек вызовов, причем либо только для метода Store, либо придумывать какой-то обобщенный интерфейс для всех методов (что уже звучит сомнительно)
 	// В общем, выглядит как очень сомнительная доработка, требующая внушительных усилий и ухудшения интерфейсов (но если я не догадался до какого-то очевидного решения - буду рад услышать)
 	if s.persister != nil {
-		if err := s.persister.Store(urlEntity); err != nil {
+		if err := s.persister.Store(s.stored(urlEntity)); err != nil {
 			log.Error().Err(err).Msg("error while writing to file")
 			return err
 		}
@@ -68,11 +168,142 @@ func (s *inMemoryRepo) Store(_ context.Context, urlEntity URLEntity) error {
 	return nil
 }
 
-func (s *inMemoryRepo) StoreBatch(_ context.Context, entitiesBatch []URLEntity) error {
+// StoreBatch implements URLRepository.StoreBatch
+// Ссылки сохраняются независимо: уже сохраненные ссылки и ссылки с занятым идентификатором пропускаются, остальные сохраняются
+func (s *inMemoryRepo) StoreBatch(_ context.Context, entitiesBatch []URLEntity) ([]error, error) {
 	s.mx.Lock()
 	defer s.mx.Unlock()
-	for _, urlEntity := range entitiesBatch {
-		s.m[urlEntity.ID] = urlEntity
+	itemErrs := make([]error, len(entitiesBatch))
+	now := time.Now().UTC()
+	for idx, urlEntity := range entitiesBatch {
+		urlEntity = urlEntity.created(now)
+		// индексы обновляются после каждой ссылки, поэтому дубликаты внутри пакета тоже обнаруживаются
+		if err := s.checkOriginalURLAvailable(urlEntity); err != nil {
+			itemErrs[idx] = err
+			continue
+		}
+		if err := s.checkIDAvailable(urlEntity); err != nil {
+			itemErrs[idx] = err
+			continue
+		}
+		s.put(urlEntity)
+		if s.persister != nil {
+			if err := s.persister.Store(s.stored(urlEntity)); err != nil {
+				log.Error().Err(err).Msg("error while writing to file")
+				return nil, err
+			}
+		}
+	}
+	return itemErrs, nil
+}
+
+// originalURLKey возвращает ключ обратного индекса для ссылки. false - оригинальные ссылки не уникальны и индекс не ведется
+func (s *inMemoryRepo) originalURLKey(urlEntity URLEntity) (string, bool) {
+	switch s.uniquenessScope {
+	case UserUniqueness:
+		return urlEntity.UserID + "\t" + urlEntity.OriginalURL, true
+	case NoUniqueness:
+		return "", false
+	default:
+		return urlEntity.OriginalURL, true
+	}
+}
+
+// put сохраняет ссылку в map и обновляет индексы. Новой ссылке присваивается следующий порядковый номер
+func (s *inMemoryRepo) put(urlEntity URLEntity) {
+	s.putAt(urlEntity, 0)
+}
+
+// putAt аналогичен put, но новой ссылке присваивается порядковый номер position, сохраненный в файле.
+// Номера в файле возрастают в порядке записи; отсутствующий (0) или не больший последнего номер заменяется следующим,
+// чтобы ссылки пользователя в byUser оставались упорядочены по номерам
+func (s *inMemoryRepo) putAt(urlEntity URLEntity, position uint64) {
+	if previous, ok := s.m[urlEntity.ID]; !ok {
+		if position <= s.lastPosition {
+			position = s.lastPosition + 1
+		}
+		s.lastPosition = position
+		s.positions[urlEntity.ID] = position
+		s.byUser[urlEntity.UserID] = append(s.byUser[urlEntity.UserID], urlEntity.ID)
+	} else if key, ok := s.originalURLKey(previous); ok && s.byOriginalURL[key] == urlEntity.ID {
+		// оригинальная ссылка могла измениться
+		delete(s.byOriginalURL, key)
+	}
+	s.m[urlEntity.ID] = urlEntity
+	if key, ok := s.originalURLKey(urlEntity); ok {
+		// истекшая ссылка не занимает оригинальную ссылку (см. checkOriginalURLAvailable) и заменяется новой.
+		// В файле она остается до ближайшей очистки, поэтому при загрузке из файла тоже заменяется
+		if holderID, ok := s.byOriginalURL[key]; ok && holderID != urlEntity.ID {
+			if holder := s.m[holderID]; holder.IsExpired(time.Now()) {
+				s.remove(holder)
+			}
+		}
+		s.byOriginalURL[key] = urlEntity.ID
+	}
+}
+
+// remove удаляет ссылку из map и индексов
+func (s *inMemoryRepo) remove(urlEntity URLEntity) {
+	userIDs := s.byUser[urlEntity.UserID]
+	idx := s.userPositionIndex(userIDs, s.positions[urlEntity.ID])
+	if idx < len(userIDs) && userIDs[idx] == urlEntity.ID {
+		s.byUser[urlEntity.UserID] = append(userIDs[:idx], userIDs[idx+1:]...)
+	}
+	if len(s.byUser[urlEntity.UserID]) == 0 {
+		delete(s.byUser, urlEntity.UserID)
+	}
+	delete(s.positions, urlEntity.ID)
+	delete(s.m, urlEntity.ID)
+	s.clicksMx.Lock()
+	delete(s.clicks, urlEntity.ID)
+	s.clicksMx.Unlock()
+	if key, ok := s.originalURLKey(urlEntity); ok && s.byOriginalURL[key] == urlEntity.ID {
+		delete(s.byOriginalURL, key)
+	}
+}
+
+// userPositionIndex возвращает индекс первой ссылки в ids (идентификаторы ссылок пользователя в порядке создания)
+// с порядковым номером не меньше position
+func (s *inMemoryRepo) userPositionIndex(ids []string, position uint64) int {
+	return sort.Search(len(ids), func(i int) bool {
+		return s.positions[ids[i]] >= position
+	})
+}
+
+// stored возвращает ссылку с ее порядковым номером для записи в файл
+func (s *inMemoryRepo) stored(urlEntity URLEntity) storedURL {
+	return storedURL{URLEntity: urlEntity, position: s.positions[urlEntity.ID]}
+}
+
+// ordered возвращает все ссылки в порядке создания
+func (s *inMemoryRepo) ordered() []storedURL {
+	urls := make([]storedURL, 0, len(s.m))
+	for _, entity := range s.m {
+		urls = append(urls, s.stored(entity))
+	}
+	sort.Slice(urls, func(i, j int) bool {
+		return urls[i].position < urls[j].position
+	})
+	return urls
+}
+
+// checkOriginalURLAvailable проверяет, что оригинальная ссылка еще не сохранена (в рамках области уникальности).
+// Если сохранена - возвращает ErrURLExists с ее идентификатором. Истекшая ссылка оригинальную ссылку не занимает
+func (s *inMemoryRepo) checkOriginalURLAvailable(urlEntity URLEntity) error {
+	key, ok := s.originalURLKey(urlEntity)
+	if !ok {
+		return nil
+	}
+	if id, ok := s.byOriginalURL[key]; ok && !s.m[id].IsExpired(time.Now()) {
+		return NewErrURLExists(id)
+	}
+	return nil
+}
+
+// checkIDAvailable проверяет, что идентификатор ссылки не занят
+func (s *inMemoryRepo) checkIDAvailable(urlEntity URLEntity) error {
+	if _, ok := s.m[urlEntity.ID]; ok {
+		return NewErrURLIDConflict(urlEntity.ID)
 	}
 	return nil
 }
@@ -89,17 +320,75 @@ func (s *inMemoryRepo) Load(_ context.Context, key string) (urlEntity URLEntity,
 }
 
 // DeleteURLs implements URLRepository.DeleteURLs
-func (s *inMemoryRepo) DeleteURLs(_ context.Context, userID string, ids []string) error {
+func (s *inMemoryRepo) DeleteURLs(_ context.Context, userID string, ids []string) ([]string, error) {
 	s.mx.Lock()
 	defer s.mx.Unlock()
 
+	now := time.Now().UTC()
+	deleted := make([]string, 0, len(ids))
 	for _, id := range ids {
-		if entity, ok := s.m[id]; ok && entity.UserID == userID {
-			entity.Deleted = true
+		entity, ok := s.m[id]
+		if !ok || entity.UserID != userID {
+			continue
+		}
+		// повторное удаление не меняет время удаления
+		if !entity.Deleted {
+			entity = entity.markDeleted(now)
 			s.m[id] = entity
 
 			if s.persister != nil {
-				if err := s.persister.Store(entity); err != nil {
+				if err := s.persister.Store(s.stored(entity)); err != nil {
+					log.Error().Err(err).Msg("error while writing to file")
+					return deleted, err
+				}
+			}
+		}
+		deleted = append(deleted, id)
+	}
+	return deleted, nil
+}
+
+// UpdateOriginalURL implements URLRepository.UpdateOriginalURL
+func (s *inMemoryRepo) UpdateOriginalURL(_ context.Context, userID string, id string, originalURL string) (URLEntity, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	entity, ok := s.m[id]
+	if !ok || entity.UserID != userID || entity.Deleted {
+		return URLEntity{}, ErrURLNotFound
+	}
+	if entity.OriginalURL == originalURL {
+		return entity, nil
+	}
+	entity.OriginalURL = originalURL
+	if err := s.checkOriginalURLAvailable(entity); err != nil {
+		return URLEntity{}, err
+	}
+	entity.UpdatedAt = time.Now().UTC()
+	s.put(entity)
+
+	if s.persister != nil {
+		if err := s.persister.Store(s.stored(entity)); err != nil {
+			log.Error().Err(err).Msg("error while writing to file")
+			return URLEntity{}, err
+		}
+	}
+	return entity, nil
+}
+
+// RestoreURLs implements URLRepository.RestoreURLs
+func (s *inMemoryRepo) RestoreURLs(_ context.Context, userID string, ids []string) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	now := time.Now().UTC()
+	for _, id := range ids {
+		if entity, ok := s.m[id]; ok && entity.UserID == userID && entity.Deleted {
+			entity = entity.restored(now)
+			s.m[id] = entity
+
+			if s.persister != nil {
+				if err := s.persister.Store(s.stored(entity)); err != nil {
 					log.Error().Err(err).Msg("error while writing to file")
 					return err
 				}
@@ -113,16 +402,250 @@ func (s *inMemoryRepo) DeleteURLs(_ context.Context, userID string, ids []string
 func (s *inMemoryRepo) LoadByUserID(_ context.Context, userID string) ([]URLEntity, error) {
 	s.mx.RLock()
 	defer s.mx.RUnlock()
-	entities := make([]URLEntity, 0)
+	ids := s.byUser[userID]
+	entities := make([]URLEntity, len(ids))
+	for idx, id := range ids {
+		entities[idx] = s.m[id]
+	}
+	return entities, nil
+}
+
+// LoadPageByUserID implements URLRepository.LoadPageByUserID
+func (s *inMemoryRepo) LoadPageByUserID(_ context.Context, query URLPageQuery) (URLPage, error) {
+	cursor, err := decodeCursor(query.Cursor)
+	if err != nil {
+		return URLPage{}, err
+	}
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	ids := s.byUser[query.UserID]
+	// idx - индекс первой ссылки страницы, step - направление обхода
+	idx, step := 0, 1
+	if query.Descending {
+		idx, step = len(ids)-1, -1
+	}
+	if cursor > 0 {
+		idx = s.userPositionIndex(ids, cursor)
+		if query.Descending {
+			idx--
+		} else if idx < len(ids) && s.positions[ids[idx]] == cursor {
+			idx++
+		}
+	}
+
+	page := URLPage{Entities: make([]URLEntity, 0, query.Limit)}
+	for ; idx >= 0 && idx < len(ids); idx += step {
+		entity := s.m[ids[idx]]
+		if !matchesPageQuery(entity, query) {
+			continue
+		}
+		if len(page.Entities) == query.Limit {
+			page.NextCursor = encodeCursor(s.positions[page.Entities[len(page.Entities)-1].ID])
+			break
+		}
+		page.Entities = append(page.Entities, entity)
+	}
+	return page, nil
+}
+
+// PurgeExpired implements URLRepository.PurgeExpired
+func (s *inMemoryRepo) PurgeExpired(_ context.Context, before time.Time) (int, error) {
+	return s.purge(func(entity URLEntity) bool {
+		return entity.IsExpired(before)
+	})
+}
+
+// PurgeDeleted implements URLRepository.PurgeDeleted
+func (s *inMemoryRepo) PurgeDeleted(_ context.Context, before time.Time) (int, error) {
+	return s.purge(func(entity URLEntity) bool {
+		return entity.IsDeletedBefore(before)
+	})
+}
+
+// purge окончательно удаляет ссылки, подходящие под match
+func (s *inMemoryRepo) purge(match func(URLEntity) bool) (int, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	purged := 0
 	for _, entity := range s.m {
-		if entity.UserID == userID {
-			entities = append(entities, entity)
+		if match(entity) {
+			s.remove(entity)
+			purged++
 		}
 	}
-	return entities, nil
+
+	// файл дописывается только в конец, поэтому чтобы удаленные ссылки не восстановились при следующем старте - перезаписываем его целиком.
+	// Статистику тоже, иначе она перейдет к новой ссылке с тем же идентификатором
+	if purged > 0 && s.persister != nil {
+		if err := s.persister.Rewrite(s.ordered()); err != nil {
+			log.Error().Err(err).Msg("error while rewriting file")
+			return purged, err
+		}
+		s.clicksMx.Lock()
+		defer s.clicksMx.Unlock()
+		if err := s.persister.RewriteClicks(s.clicks); err != nil {
+			log.Error().Err(err).Msg("error while rewriting clicks file")
+			return purged, err
+		}
+	}
+	return purged, nil
+}
+
+// RecordClick implements ClickRepository.RecordClick
+// Статистика переходов хранится в памяти в виде счетчиков (см. clickCounter), переходы дописываются в журнал статистики рядом с основным файлом
+func (s *inMemoryRepo) RecordClick(_ context.Context, click Click) error {
+	s.clicksMx.Lock()
+	defer s.clicksMx.Unlock()
+	if s.persister != nil {
+		if err := s.persister.StoreClick(click); err != nil {
+			log.Error().Err(err).Msg("error while writing click to file")
+			return err
+		}
+	}
+	counter, ok := s.clicks[click.URLID]
+	if !ok {
+		counter = newClickCounter()
+		s.clicks[click.URLID] = counter
+	}
+	counter.add(click)
+	return nil
+}
+
+// LoadStats implements ClickRepository.LoadStats
+func (s *inMemoryRepo) LoadStats(_ context.Context, urlID string) (URLStats, error) {
+	s.clicksMx.RLock()
+	defer s.clicksMx.RUnlock()
+	counter, ok := s.clicks[urlID]
+	if !ok {
+		return newClickCounter().stats(), nil
+	}
+	return counter.stats(), nil
+}
+
+// NextSequenceValue implements SequenceRepository.NextSequenceValue
+// Чтобы не писать в файл на каждое значение, значения резервируются блоками. При перезапуске невыданный остаток блока пропускается
+func (s *inMemoryRepo) NextSequenceValue(_ context.Context) (uint64, error) {
+	s.seqMx.Lock()
+	defer s.seqMx.Unlock()
+	if s.seqLast >= s.seqReserved {
+		reserved := s.seqReserved + sequenceReserveBlock
+		if s.persister != nil {
+			if err := s.persister.StoreSequence(reserved); err != nil {
+				log.Error().Err(err).Msg("error while writing sequence to file")
+				return 0, err
+			}
+		}
+		s.seqReserved = reserved
+	}
+	s.seqLast++
+	return s.seqLast, nil
+}
+
+// EnqueueDeletion implements DeletionQueueRepository.EnqueueDeletion
+func (s *inMemoryRepo) EnqueueDeletion(_ context.Context, req DeletionRequest) error {
+	s.deletionsMx.Lock()
+	defer s.deletionsMx.Unlock()
+	if s.persister != nil {
+		if err := s.persister.StoreDeletion(req); err != nil {
+			log.Error().Err(err).Msg("error while writing deletion request to file")
+			return err
+		}
+	}
+	s.deletions = append(s.deletions, req)
+	return nil
+}
+
+// PendingDeletions implements DeletionQueueRepository.PendingDeletions
+func (s *inMemoryRepo) PendingDeletions(_ context.Context) ([]DeletionRequest, error) {
+	s.deletionsMx.Lock()
+	defer s.deletionsMx.Unlock()
+	return append([]DeletionRequest(nil), s.deletions...), nil
+}
+
+// CompleteDeletions implements DeletionQueueRepository.CompleteDeletions
+// Когда очередь пустеет, журнал очереди очищается, чтобы не рос бесконечно
+func (s *inMemoryRepo) CompleteDeletions(_ context.Context, ids []string) error {
+	s.deletionsMx.Lock()
+	defer s.deletionsMx.Unlock()
+	completed := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		completed[id] = struct{}{}
+	}
+	pending := s.deletions[:0]
+	for _, req := range s.deletions {
+		if _, ok := completed[req.ID]; !ok {
+			pending = append(pending, req)
+		}
+	}
+	s.deletions = pending
+
+	if s.persister == nil {
+		return nil
+	}
+	var err error
+	if len(s.deletions) == 0 {
+		err = s.persister.RewriteDeletions(nil)
+	} else {
+		err = s.persister.CompleteDeletions(ids)
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("error while writing deletion queue to file")
+	}
+	return err
+}
+
+// CancelDeletions implements DeletionQueueRepository.CancelDeletions
+func (s *inMemoryRepo) CancelDeletions(_ context.Context, userID string, urlIDs []string) error {
+	s.deletionsMx.Lock()
+	defer s.deletionsMx.Unlock()
+	cancelled := make(map[string]struct{}, len(urlIDs))
+	for _, id := range urlIDs {
+		cancelled[id] = struct{}{}
+	}
+	changed := false
+	for idx, req := range s.deletions {
+		if req.UserID != userID {
+			continue
+		}
+		// запрос копируется, чтобы не менять срезы, уже отданные PendingDeletions
+		remaining := make([]string, 0, len(req.URLIDs))
+		for _, id := range req.URLIDs {
+			if _, ok := cancelled[id]; !ok {
+				remaining = append(remaining, id)
+			}
+		}
+		if len(remaining) != len(req.URLIDs) {
+			s.deletions[idx].URLIDs = remaining
+			changed = true
+		}
+	}
+
+	if !changed || s.persister == nil {
+		return nil
+	}
+	if err := s.persister.RewriteDeletions(s.deletions); err != nil {
+		log.Error().Err(err).Msg("error while writing deletion queue to file")
+		return err
+	}
+	return nil
 }
 
 // Ping implements URLRepository.Ping
 func (s *inMemoryRepo) Ping(_ context.Context) error {
 	return nil
 }
+
+// Close implements URLRepository.Close
+func (s *inMemoryRepo) Close() error {
+	if s.persister == nil {
+		return nil
+	}
+	// ждем завершения начатых записей
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.deletionsMx.Lock()
+	defer s.deletionsMx.Unlock()
+	return s.persister.Sync()
+}
@@ -0,0 +1,568 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// reopen закрывает хранилище и создает новое из того же файла, как при перезапуске сервиса
+func reopen(t *testing.T, repo *inMemoryRepo, filename string) *inMemoryRepo {
+	require.NoError(t, repo.Close())
+	reopened, err := NewInMemoryRepository(WithFilePersistance(filename))
+	require.NoError(t, err)
+	return reopened
+}
+
+func Test_inMemoryRepo_Reload(t *testing.T) {
+	ctx := context.Background()
+	filename := filepath.Join(t.TempDir(), "urls")
+	repo, err := NewInMemoryRepository(WithFilePersistance(filename))
+	require.NoError(t, err)
+
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	require.NoError(t, repo.Store(ctx, URLEntity{ID: "google", OriginalURL: "http://google.com", UserID: "user1"}))
+	require.NoError(t, repo.Store(ctx, URLEntity{ID: "yandex", OriginalURL: "http://yandex.ru", UserID: "user1", ExpiresAt: &expiresAt}))
+	itemErrs, err := repo.StoreBatch(ctx, []URLEntity{
+		{ID: "ya", OriginalURL: "http://ya.ru", UserID: "user2"},
+		{ID: "bing", OriginalURL: "http://bing.com", UserID: "user1"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []error{nil, nil}, itemErrs)
+	_, err = repo.DeleteURLs(ctx, "user1", []string{"bing"})
+	require.NoError(t, err)
+	_, err = repo.UpdateOriginalURL(ctx, "user2", "ya", "http://ya.ru/search")
+	require.NoError(t, err)
+
+	want, err := repo.LoadByUserID(ctx, "user1")
+	require.NoError(t, err)
+	repo = reopen(t, repo, filename)
+
+	got, err := repo.LoadByUserID(ctx, "user1")
+	require.NoError(t, err)
+	require.Len(t, got, 3)
+	for idx := range want {
+		assert.Equal(t, want[idx].ID, got[idx].ID, "order of creation should be kept")
+		assert.Equal(t, want[idx].OriginalURL, got[idx].OriginalURL)
+		assert.Equal(t, want[idx].Deleted, got[idx].Deleted)
+		assert.True(t, want[idx].CreatedAt.Equal(got[idx].CreatedAt))
+	}
+	require.NotNil(t, got[1].ExpiresAt)
+	assert.True(t, expiresAt.Equal(*got[1].ExpiresAt))
+	assert.NotNil(t, got[2].DeletedAt)
+
+	ya, err := repo.Load(ctx, "ya")
+	require.NoError(t, err)
+	assert.Equal(t, "http://ya.ru/search", ya.OriginalURL, "later records should override earlier ones")
+
+	var errExists *ErrURLExists
+	require.True(t, errors.As(repo.Store(ctx, URLEntity{ID: "other", OriginalURL: "http://google.com", UserID: "user2"}), &errExists),
+		"original url index should be restored")
+	assert.Equal(t, "google", errExists.ID)
+	assert.NoError(t, repo.Store(ctx, URLEntity{ID: "oldYa", OriginalURL: "http://ya.ru", UserID: "user2"}),
+		"original url replaced by update should be free")
+}
+
+func Test_inMemoryRepo_Store_Errors(t *testing.T) {
+	existing := URLEntity{ID: "google", OriginalURL: "http://google.com", UserID: "user1"}
+	tests := []struct {
+		name       string
+		scope      UniquenessScope
+		entity     URLEntity
+		wantExists string
+		wantIDErr  bool
+	}{
+		{
+			name:       "should report existing original url",
+			scope:      GlobalUniqueness,
+			entity:     URLEntity{ID: "other", OriginalURL: "http://google.com", UserID: "user2"},
+			wantExists: "google",
+		},
+		{
+			name:       "should check original url before id",
+			scope:      GlobalUniqueness,
+			entity:     URLEntity{ID: "google", OriginalURL: "http://google.com", UserID: "user1"},
+			wantExists: "google",
+		},
+		{
+			name:      "should report taken id",
+			scope:     GlobalUniqueness,
+			entity:    URLEntity{ID: "google", OriginalURL: "http://yandex.ru", UserID: "user1"},
+			wantIDErr: true,
+		},
+		{
+			name:   "should allow same original url of another user in user scope",
+			scope:  UserUniqueness,
+			entity: URLEntity{ID: "other", OriginalURL: "http://google.com", UserID: "user2"},
+		},
+		{
+			name:       "should report existing original url of same user in user scope",
+			scope:      UserUniqueness,
+			entity:     URLEntity{ID: "other", OriginalURL: "http://google.com", UserID: "user1"},
+			wantExists: "google",
+		},
+		{
+			name:   "should allow same original url without uniqueness",
+			scope:  NoUniqueness,
+			entity: URLEntity{ID: "other", OriginalURL: "http://google.com", UserID: "user1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, batch := range []bool{false, true} {
+				repo, err := NewInMemoryRepository(WithUniquenessScope(tt.scope))
+				require.NoError(t, err)
+				require.NoError(t, repo.Store(context.Background(), existing))
+
+				if batch {
+					var itemErrs []error
+					itemErrs, err = repo.StoreBatch(context.Background(), []URLEntity{tt.entity})
+					require.NoError(t, err)
+					require.Len(t, itemErrs, 1)
+					err = itemErrs[0]
+				} else {
+					err = repo.Store(context.Background(), tt.entity)
+				}
+
+				var errExists *ErrURLExists
+				var errIDConflict *ErrURLIDConflict
+				switch {
+				case tt.wantExists != "":
+					require.True(t, errors.As(err, &errExists), "batch: %t, got %v", batch, err)
+					assert.Equal(t, tt.wantExists, errExists.ID)
+				case tt.wantIDErr:
+					require.True(t, errors.As(err, &errIDConflict), "batch: %t, got %v", batch, err)
+					assert.Equal(t, tt.entity.ID, errIDConflict.ID)
+				default:
+					assert.NoError(t, err, "batch: %t", batch)
+				}
+			}
+		})
+	}
+}
+
+func Test_inMemoryRepo_OriginalURLIndex(t *testing.T) {
+	tests := []struct {
+		name   string
+		url    string
+		modify func(t *testing.T, repo *inMemoryRepo)
+	}{
+		{
+			name: "should free original url on update",
+			url:  "http://google.com",
+			modify: func(t *testing.T, repo *inMemoryRepo) {
+				_, err := repo.UpdateOriginalURL(context.Background(), "user1", "google", "http://google.com/search")
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "should free original url on purge",
+			url:  "http://google.com",
+			modify: func(t *testing.T, repo *inMemoryRepo) {
+				_, err := repo.DeleteURLs(context.Background(), "user1", []string{"google"})
+				require.NoError(t, err)
+				purged, err := repo.PurgeDeleted(context.Background(), time.Now().Add(time.Second))
+				require.NoError(t, err)
+				assert.Equal(t, 1, purged)
+			},
+		},
+		{
+			name:   "should replace expired link",
+			url:    "http://expired.com",
+			modify: func(t *testing.T, repo *inMemoryRepo) {},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, err := NewInMemoryRepository()
+			require.NoError(t, err)
+			expiresAt := time.Now().Add(-time.Hour)
+			require.NoError(t, repo.Store(context.Background(), URLEntity{ID: "google", OriginalURL: "http://google.com", UserID: "user1"}))
+			require.NoError(t, repo.Store(context.Background(), URLEntity{ID: "expired", OriginalURL: "http://expired.com", UserID: "user1", ExpiresAt: &expiresAt}))
+
+			tt.modify(t, repo)
+
+			require.NoError(t, repo.Store(context.Background(), URLEntity{ID: "new", OriginalURL: tt.url, UserID: "user2"}))
+			var errExists *ErrURLExists
+			require.True(t, errors.As(repo.Store(context.Background(), URLEntity{ID: "third", OriginalURL: tt.url, UserID: "user3"}), &errExists))
+			assert.Equal(t, "new", errExists.ID, "index should point to the new link")
+		})
+	}
+}
+
+func Test_inMemoryRepo_LoadPageByUserID(t *testing.T) {
+	ctx := context.Background()
+	repo, err := NewInMemoryRepository()
+	require.NoError(t, err)
+	for _, id := range []string{"1", "2", "3", "4", "5"} {
+		require.NoError(t, repo.Store(ctx, URLEntity{ID: id, OriginalURL: "http://google.com/" + id, UserID: "user"}))
+		require.NoError(t, repo.Store(ctx, URLEntity{ID: "other" + id, OriginalURL: "http://yandex.ru/" + id, UserID: "other"}))
+	}
+	// курсор ссылки, которая будет удалена до запроса следующей страницы
+	purgedCursor := encodeCursor(repo.positions["3"])
+	_, err = repo.DeleteURLs(ctx, "user", []string{"3"})
+	require.NoError(t, err)
+	_, err = repo.PurgeDeleted(ctx, time.Now().Add(time.Second))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		query URLPageQuery
+		// pages идентификаторы ссылок на страницах, пока не закончится курсор
+		pages   [][]string
+		wantErr error
+	}{
+		{
+			name:  "should return pages in creation order",
+			query: URLPageQuery{UserID: "user", Limit: 2},
+			pages: [][]string{{"1", "2"}, {"4", "5"}},
+		},
+		{
+			name:  "should return pages in reverse order",
+			query: URLPageQuery{UserID: "user", Limit: 3, Descending: true},
+			pages: [][]string{{"5", "4", "2"}, {"1"}},
+		},
+		{
+			name:  "should not return cursor when page is last",
+			query: URLPageQuery{UserID: "user", Limit: 4},
+			pages: [][]string{{"1", "2", "4", "5"}},
+		},
+		{
+			name:  "should continue after cursor of purged link",
+			query: URLPageQuery{UserID: "user", Limit: 10, Cursor: purgedCursor},
+			pages: [][]string{{"4", "5"}},
+		},
+		{
+			name:  "should continue before cursor of purged link in reverse order",
+			query: URLPageQuery{UserID: "user", Limit: 10, Cursor: purgedCursor, Descending: true},
+			pages: [][]string{{"2", "1"}},
+		},
+		{
+			name:  "should filter by original url",
+			query: URLPageQuery{UserID: "user", Limit: 1, OriginalURLContains: "/5"},
+			pages: [][]string{{"5"}},
+		},
+		{
+			name:  "should return empty page for user without links",
+			query: URLPageQuery{UserID: "nobody", Limit: 2},
+			pages: [][]string{{}},
+		},
+		{
+			name:    "should reject invalid cursor",
+			query:   URLPageQuery{UserID: "user", Limit: 2, Cursor: "not a cursor"},
+			wantErr: ErrInvalidCursor,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := tt.query
+			var pages [][]string
+			for {
+				page, err := repo.LoadPageByUserID(ctx, query)
+				if tt.wantErr != nil {
+					assert.ErrorIs(t, err, tt.wantErr)
+					return
+				}
+				require.NoError(t, err)
+				ids := make([]string, 0, len(page.Entities))
+				for _, entity := range page.Entities {
+					ids = append(ids, entity.ID)
+				}
+				pages = append(pages, ids)
+				if page.NextCursor == "" {
+					break
+				}
+				query.Cursor = page.NextCursor
+			}
+			assert.Equal(t, tt.pages, pages)
+		})
+	}
+}
+
+func Test_inMemoryRepo_LoadPageByUserID_Reload(t *testing.T) {
+	ctx := context.Background()
+	filename := filepath.Join(t.TempDir(), "urls")
+	repo, err := NewInMemoryRepository(WithFilePersistance(filename))
+	require.NoError(t, err)
+	// ссылка другого пользователя в начале файла, чтобы после очистки номера остальных ссылок сместились при перенумерации
+	require.NoError(t, repo.Store(ctx, URLEntity{ID: "other", OriginalURL: "http://other.com", UserID: "other"}))
+	for _, id := range []string{"1", "2", "3", "4"} {
+		require.NoError(t, repo.Store(ctx, URLEntity{ID: id, OriginalURL: "http://google.com/" + id, UserID: "user"}))
+	}
+
+	pageIDs := func(page URLPage) []string {
+		ids := make([]string, 0, len(page.Entities))
+		for _, entity := range page.Entities {
+			ids = append(ids, entity.ID)
+		}
+		return ids
+	}
+	page, err := repo.LoadPageByUserID(ctx, URLPageQuery{UserID: "user", Limit: 2})
+	require.NoError(t, err)
+	require.Equal(t, []string{"1", "2"}, pageIDs(page))
+	cursor := page.NextCursor
+
+	repo = reopen(t, repo, filename)
+	page, err = repo.LoadPageByUserID(ctx, URLPageQuery{UserID: "user", Limit: 2, Cursor: cursor})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3", "4"}, pageIDs(page), "cursor should stay valid after restart")
+
+	_, err = repo.DeleteURLs(ctx, "other", []string{"other"})
+	require.NoError(t, err)
+	purged, err := repo.PurgeDeleted(ctx, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	require.Equal(t, 1, purged)
+	page, err = repo.LoadPageByUserID(ctx, URLPageQuery{UserID: "user", Limit: 2, Cursor: cursor})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3", "4"}, pageIDs(page), "cursor should stay valid after purge")
+
+	repo = reopen(t, repo, filename)
+	page, err = repo.LoadPageByUserID(ctx, URLPageQuery{UserID: "user", Limit: 2, Cursor: cursor})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3", "4"}, pageIDs(page), "cursor should stay valid after restart following purge")
+
+	require.NoError(t, repo.Store(ctx, URLEntity{ID: "5", OriginalURL: "http://google.com/5", UserID: "user"}))
+	page, err = repo.LoadPageByUserID(ctx, URLPageQuery{UserID: "user", Limit: 10, Cursor: cursor})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3", "4", "5"}, pageIDs(page), "new links should follow restored ones")
+}
+
+func Test_inMemoryRepo_Purge_Reload(t *testing.T) {
+	ctx := context.Background()
+	filename := filepath.Join(t.TempDir(), "urls")
+	repo, err := NewInMemoryRepository(WithFilePersistance(filename))
+	require.NoError(t, err)
+
+	expiredAt := time.Now().Add(-time.Hour)
+	require.NoError(t, repo.Store(ctx, URLEntity{ID: "google", OriginalURL: "http://google.com", UserID: "user"}))
+	require.NoError(t, repo.Store(ctx, URLEntity{ID: "expired", OriginalURL: "http://expired.com", UserID: "user", ExpiresAt: &expiredAt}))
+	require.NoError(t, repo.Store(ctx, URLEntity{ID: "deleted", OriginalURL: "http://deleted.com", UserID: "user"}))
+	require.NoError(t, repo.Store(ctx, URLEntity{ID: "yandex", OriginalURL: "http://yandex.ru", UserID: "user"}))
+	_, err = repo.DeleteURLs(ctx, "user", []string{"deleted"})
+	require.NoError(t, err)
+
+	purged, err := repo.PurgeExpired(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	purged, err = repo.PurgeDeleted(ctx, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	// записи после перезаписи файла дописываются к нему
+	require.NoError(t, repo.Store(ctx, URLEntity{ID: "ya", OriginalURL: "http://ya.ru", UserID: "user"}))
+
+	repo = reopen(t, repo, filename)
+
+	entities, err := repo.LoadByUserID(ctx, "user")
+	require.NoError(t, err)
+	ids := make([]string, 0, len(entities))
+	for _, entity := range entities {
+		ids = append(ids, entity.ID)
+	}
+	assert.Equal(t, []string{"google", "yandex", "ya"}, ids)
+	for _, id := range []string{"expired", "deleted"} {
+		_, err = repo.Load(ctx, id)
+		assert.ErrorIs(t, err, ErrURLNotFound, "purged link %s should not be restored", id)
+	}
+	assert.NoError(t, repo.Store(ctx, URLEntity{ID: "newDeleted", OriginalURL: "http://deleted.com", UserID: "user"}),
+		"original url of purged link should be free after reload")
+}
+
+func Test_inMemoryRepo_DeletionQueue_Reload(t *testing.T) {
+	ctx := context.Background()
+	filename := filepath.Join(t.TempDir(), "urls")
+	repo, err := NewInMemoryRepository(WithFilePersistance(filename))
+	require.NoError(t, err)
+
+	createdAt := time.Now().UTC().Truncate(time.Second)
+	first := DeletionRequest{ID: "first", UserID: "user1", URLIDs: []string{"google", "yandex"}, CreatedAt: createdAt}
+	second := DeletionRequest{ID: "second", UserID: "user2", URLIDs: []string{"ya"}, CreatedAt: createdAt.Add(time.Second)}
+	require.NoError(t, repo.EnqueueDeletion(ctx, first))
+	require.NoError(t, repo.EnqueueDeletion(ctx, second))
+
+	pendingIDs := func(repo *inMemoryRepo) []string {
+		pending, err := repo.PendingDeletions(ctx)
+		require.NoError(t, err)
+		ids := make([]string, 0, len(pending))
+		for _, req := range pending {
+			ids = append(ids, req.ID)
+		}
+		return ids
+	}
+
+	repo = reopen(t, repo, filename)
+	pending, err := repo.PendingDeletions(ctx)
+	require.NoError(t, err)
+	require.Len(t, pending, 2, "pending deletions should be replayed after restart")
+	assert.Equal(t, first.URLIDs, pending[0].URLIDs)
+	assert.Equal(t, first.UserID, pending[0].UserID)
+	assert.True(t, first.CreatedAt.Equal(pending[0].CreatedAt))
+	assert.Equal(t, "second", pending[1].ID)
+
+	require.NoError(t, repo.CompleteDeletions(ctx, []string{"first", "unknown"}))
+	repo = reopen(t, repo, filename)
+	assert.Equal(t, []string{"second"}, pendingIDs(repo), "acknowledged deletion should not be replayed")
+
+	require.NoError(t, repo.CompleteDeletions(ctx, []string{"second"}))
+	repo = reopen(t, repo, filename)
+	assert.Empty(t, pendingIDs(repo))
+
+	// журнал очищен, новые запросы пишутся в него заново
+	require.NoError(t, repo.EnqueueDeletion(ctx, DeletionRequest{ID: "third", UserID: "user1", URLIDs: []string{"bing"}, CreatedAt: createdAt}))
+	repo = reopen(t, repo, filename)
+	assert.Equal(t, []string{"third"}, pendingIDs(repo))
+}
+
+func Test_inMemoryRepo_CancelDeletions(t *testing.T) {
+	ctx := context.Background()
+	filename := filepath.Join(t.TempDir(), "urls")
+	repo, err := NewInMemoryRepository(WithFilePersistance(filename))
+	require.NoError(t, err)
+
+	require.NoError(t, repo.EnqueueDeletion(ctx, DeletionRequest{ID: "first", UserID: "user1", URLIDs: []string{"google", "yandex"}}))
+	require.NoError(t, repo.EnqueueDeletion(ctx, DeletionRequest{ID: "other", UserID: "user2", URLIDs: []string{"google"}}))
+	require.NoError(t, repo.EnqueueDeletion(ctx, DeletionRequest{ID: "second", UserID: "user1", URLIDs: []string{"google"}}))
+	replayed, err := repo.PendingDeletions(ctx)
+	require.NoError(t, err)
+
+	require.NoError(t, repo.CancelDeletions(ctx, "user1", []string{"google"}))
+	assert.Equal(t, []string{"google", "yandex"}, replayed[0].URLIDs, "already returned requests should not change")
+
+	urlIDs := func(repo *inMemoryRepo) map[string][]string {
+		pending, err := repo.PendingDeletions(ctx)
+		require.NoError(t, err)
+		result := make(map[string][]string, len(pending))
+		for _, req := range pending {
+			result[req.ID] = req.URLIDs
+		}
+		return result
+	}
+	want := map[string][]string{
+		"first":  {"yandex"},
+		"other":  {"google"},
+		"second": {},
+	}
+	assert.Equal(t, want, urlIDs(repo))
+	repo = reopen(t, repo, filename)
+	assert.Equal(t, want, urlIDs(repo), "cancelled urls should not be replayed after restart")
+}
+
+func Test_inMemoryRepo_PurgeDeleted_Legacy(t *testing.T) {
+	ctx := context.Background()
+	filename := filepath.Join(t.TempDir(), "urls")
+	// строки, записанные до появления времени удаления: 4 поля и 5 полей (со сроком действия)
+	legacy := "google\tuser\thttp://google.com\ttrue\n" +
+		"yandex\tuser\thttp://yandex.ru\ttrue\t\n"
+	require.NoError(t, os.WriteFile(filename, []byte(legacy), 0644))
+
+	loadedAt := time.Now().UTC()
+	repo, err := NewInMemoryRepository(WithFilePersistance(filename))
+	require.NoError(t, err)
+
+	purged, err := repo.PurgeDeleted(ctx, loadedAt.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 0, purged, "legacy deleted links should be kept within retention period")
+
+	google, err := repo.Load(ctx, "google")
+	require.NoError(t, err)
+	require.NotNil(t, google.DeletedAt)
+	assert.False(t, google.DeletedAt.Before(loadedAt), "deletion time should be set to load time")
+
+	repo = reopen(t, repo, filename)
+	reloaded, err := repo.Load(ctx, "google")
+	require.NoError(t, err)
+	require.NotNil(t, reloaded.DeletedAt)
+	assert.True(t, google.DeletedAt.Equal(*reloaded.DeletedAt), "deletion time should not move on restart")
+
+	purged, err = repo.PurgeDeleted(ctx, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, 2, purged, "legacy deleted links should be purged after retention period")
+}
+
+func Test_inMemoryRepo_Clicks(t *testing.T) {
+	day := time.Date(2022, 3, 10, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		clickedAt []time.Time
+		want      URLStats
+	}{
+		{
+			name:      "should count clicks by day",
+			clickedAt: []time.Time{day.Add(time.Hour), day.Add(2 * time.Hour), day.AddDate(0, 0, 1)},
+			want: URLStats{
+				Total: 3,
+				Daily: []DailyClicks{{Date: day, Count: 2}, {Date: day.AddDate(0, 0, 1), Count: 1}},
+			},
+		},
+		{
+			name:      "should drop days older than kept period but keep them in total",
+			clickedAt: []time.Time{day.AddDate(0, 0, -clickStatsDays-1), day.AddDate(0, 0, -clickStatsDays), day},
+			want: URLStats{
+				Total: 3,
+				Daily: []DailyClicks{{Date: day.AddDate(0, 0, -clickStatsDays), Count: 1}, {Date: day, Count: 1}},
+			},
+		},
+		{
+			name: "should return empty stats without clicks",
+			want: URLStats{Daily: []DailyClicks{}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, err := NewInMemoryRepository()
+			require.NoError(t, err)
+			for _, clickedAt := range tt.clickedAt {
+				require.NoError(t, repo.RecordClick(context.Background(), Click{URLID: "id", ClickedAt: clickedAt}))
+			}
+			stats, err := repo.LoadStats(context.Background(), "id")
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, stats)
+		})
+	}
+}
+
+func Test_inMemoryRepo_Clicks_Reload(t *testing.T) {
+	ctx := context.Background()
+	filename := filepath.Join(t.TempDir(), "urls")
+	repo, err := NewInMemoryRepository(WithFilePersistance(filename))
+	require.NoError(t, err)
+
+	require.NoError(t, repo.Store(ctx, URLEntity{ID: "google", OriginalURL: "http://google.com", UserID: "user"}))
+	require.NoError(t, repo.Store(ctx, URLEntity{ID: "deleted", OriginalURL: "http://deleted.com", UserID: "user"}))
+	day := time.Date(2022, 3, 10, 0, 0, 0, 0, time.UTC)
+	for _, clickedAt := range []time.Time{day.AddDate(0, 0, -clickStatsDays-1), day.Add(time.Hour), day.Add(2 * time.Hour), day.AddDate(0, 0, 1)} {
+		require.NoError(t, repo.RecordClick(ctx, Click{URLID: "google", ClickedAt: clickedAt}))
+	}
+	require.NoError(t, repo.RecordClick(ctx, Click{URLID: "deleted", ClickedAt: day}))
+	want, err := repo.LoadStats(ctx, "google")
+	require.NoError(t, err)
+	require.Equal(t, 4, want.Total)
+
+	repo = reopen(t, repo, filename)
+	got, err := repo.LoadStats(ctx, "google")
+	require.NoError(t, err)
+	assert.Equal(t, want, got, "clicks should be restored after restart")
+
+	// журнал свернут при загрузке, повторная загрузка дает ту же статистику
+	require.NoError(t, repo.RecordClick(ctx, Click{URLID: "google", ClickedAt: day.AddDate(0, 0, 1)}))
+	want.Total++
+	want.Daily[len(want.Daily)-1].Count++
+	repo = reopen(t, repo, filename)
+	got, err = repo.LoadStats(ctx, "google")
+	require.NoError(t, err)
+	assert.Equal(t, want, got, "clicks should survive several restarts")
+
+	_, err = repo.DeleteURLs(ctx, "user", []string{"deleted"})
+	require.NoError(t, err)
+	_, err = repo.PurgeDeleted(ctx, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	require.NoError(t, repo.Store(ctx, URLEntity{ID: "deleted", OriginalURL: "http://new.com", UserID: "user"}))
+	repo = reopen(t, repo, filename)
+	got, err = repo.LoadStats(ctx, "deleted")
+	require.NoError(t, err)
+	assert.Equal(t, URLStats{Daily: []DailyClicks{}}, got, "clicks of purged link should not pass to a new link with the same id")
+}
@@ -7,6 +7,8 @@ import (
 
 	mock "github.com/stretchr/testify/mock"
 	repository "github.com/thorgnir-go-study/go-musthave-shortener/internal/app/repository"
+
+	time "time"
 )
 
 // URLRepository is an autogenerated mock type for the URLRepository type
@@ -14,13 +16,13 @@ type URLRepository struct {
 	mock.Mock
 }
 
-// DeleteURLs provides a mock function with given fields: ctx, userID, ids
-func (_m *URLRepository) DeleteURLs(ctx context.Context, userID string, ids []string) error {
-	ret := _m.Called(ctx, userID, ids)
+// Close provides a mock function with given fields:
+func (_m *URLRepository) Close() error {
+	ret := _m.Called()
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, string, []string) error); ok {
-		r0 = rf(ctx, userID, ids)
+	if rf, ok := ret.Get(0).(func() error); ok {
+		r0 = rf()
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -28,6 +30,29 @@ func (_m *URLRepository) DeleteURLs(ctx context.Context, userID string, ids []st
 	return r0
 }
 
+// DeleteURLs provides a mock function with given fields: ctx, userID, ids
+func (_m *URLRepository) DeleteURLs(ctx context.Context, userID string, ids []string) ([]string, error) {
+	ret := _m.Called(ctx, userID, ids)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(context.Context, string, []string) []string); ok {
+		r0 = rf(ctx, userID, ids)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, []string) error); ok {
+		r1 = rf(ctx, userID, ids)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Load provides a mock function with given fields: ctx, key
 func (_m *URLRepository) Load(ctx context.Context, key string) (repository.URLEntity, error) {
 	ret := _m.Called(ctx, key)
@@ -72,6 +97,27 @@ func (_m *URLRepository) LoadByUserID(ctx context.Context, userID string) ([]rep
 	return r0, r1
 }
 
+// LoadPageByUserID provides a mock function with given fields: ctx, query
+func (_m *URLRepository) LoadPageByUserID(ctx context.Context, query repository.URLPageQuery) (repository.URLPage, error) {
+	ret := _m.Called(ctx, query)
+
+	var r0 repository.URLPage
+	if rf, ok := ret.Get(0).(func(context.Context, repository.URLPageQuery) repository.URLPage); ok {
+		r0 = rf(ctx, query)
+	} else {
+		r0 = ret.Get(0).(repository.URLPage)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, repository.URLPageQuery) error); ok {
+		r1 = rf(ctx, query)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Ping provides a mock function with given fields: ctx
 func (_m *URLRepository) Ping(ctx context.Context) error {
 	ret := _m.Called(ctx)
@@ -86,6 +132,62 @@ func (_m *URLRepository) Ping(ctx context.Context) error {
 	return r0
 }
 
+// PurgeDeleted provides a mock function with given fields: ctx, before
+func (_m *URLRepository) PurgeDeleted(ctx context.Context, before time.Time) (int, error) {
+	ret := _m.Called(ctx, before)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time) int); ok {
+		r0 = rf(ctx, before)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time) error); ok {
+		r1 = rf(ctx, before)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// PurgeExpired provides a mock function with given fields: ctx, before
+func (_m *URLRepository) PurgeExpired(ctx context.Context, before time.Time) (int, error) {
+	ret := _m.Called(ctx, before)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time) int); ok {
+		r0 = rf(ctx, before)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time) error); ok {
+		r1 = rf(ctx, before)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RestoreURLs provides a mock function with given fields: ctx, userID, ids
+func (_m *URLRepository) RestoreURLs(ctx context.Context, userID string, ids []string) error {
+	ret := _m.Called(ctx, userID, ids)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, []string) error); ok {
+		r0 = rf(ctx, userID, ids)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // Store provides a mock function with given fields: ctx, urlEntity
 func (_m *URLRepository) Store(ctx context.Context, urlEntity repository.URLEntity) error {
 	ret := _m.Called(ctx, urlEntity)
@@ -101,15 +203,45 @@ func (_m *URLRepository) Store(ctx context.Context, urlEntity repository.URLEnti
 }
 
 // StoreBatch provides a mock function with given fields: ctx, entitiesBatch
-func (_m *URLRepository) StoreBatch(ctx context.Context, entitiesBatch []repository.URLEntity) error {
+func (_m *URLRepository) StoreBatch(ctx context.Context, entitiesBatch []repository.URLEntity) ([]error, error) {
 	ret := _m.Called(ctx, entitiesBatch)
 
-	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, []repository.URLEntity) error); ok {
+	var r0 []error
+	if rf, ok := ret.Get(0).(func(context.Context, []repository.URLEntity) []error); ok {
 		r0 = rf(ctx, entitiesBatch)
 	} else {
-		r0 = ret.Error(0)
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]error)
+		}
 	}
 
-	return r0
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []repository.URLEntity) error); ok {
+		r1 = rf(ctx, entitiesBatch)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateOriginalURL provides a mock function with given fields: ctx, userID, id, originalURL
+func (_m *URLRepository) UpdateOriginalURL(ctx context.Context, userID string, id string, originalURL string) (repository.URLEntity, error) {
+	ret := _m.Called(ctx, userID, id, originalURL)
+
+	var r0 repository.URLEntity
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string) repository.URLEntity); ok {
+		r0 = rf(ctx, userID, id, originalURL)
+	} else {
+		r0 = ret.Get(0).(repository.URLEntity)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, string) error); ok {
+		r1 = rf(ctx, userID, id, originalURL)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
 }
@@ -3,9 +3,13 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
 	_ "github.com/jackc/pgx/v4/stdlib"
 	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog/log"
+	"math"
 	"time"
 )
 
@@ -14,14 +18,29 @@ type postgresURLRepository struct {
 }
 
 var (
-	insertStmt         *sqlx.NamedStmt
-	batchInsertStmt    *sqlx.NamedStmt
-	getByURLIDStmt     *sqlx.Stmt
-	selectByUserIDStmt *sqlx.Stmt
-	batchDeleteStmt    *sqlx.Stmt
+	insertStmt            *sqlx.NamedStmt
+	deleteExpiredURLStmt  *sqlx.NamedStmt
+	getByURLIDStmt        *sqlx.Stmt
+	selectByUserIDStmt    *sqlx.Stmt
+	selectPageAscStmt     *sqlx.Stmt
+	selectPageDescStmt    *sqlx.Stmt
+	selectForUpdateStmt   *sqlx.Stmt
+	updateOriginalURLStmt *sqlx.NamedStmt
+	batchDeleteStmt       *sqlx.Stmt
+	batchRestoreStmt      *sqlx.Stmt
+	purgeExpiredStmt      *sqlx.Stmt
+	purgeDeletedStmt      *sqlx.Stmt
+	insertClickStmt       *sqlx.NamedStmt
+	selectDailyClicksStmt *sqlx.Stmt
+	nextSequenceValueStmt *sqlx.Stmt
+	enqueueDeletionStmt   *sqlx.Stmt
+	pendingDeletionsStmt  *sqlx.Stmt
+	completeDeletionsStmt *sqlx.Stmt
+	cancelDeletionsStmt   *sqlx.Stmt
 )
 
-func NewPostgresURLRepository(ctx context.Context, connectionString string) (*postgresURLRepository, error) {
+// NewPostgresURLRepository создает хранилище ссылок в БД. migrateScope разрешает изменить область уникальности, записанную в БД, на scope (см. migrateUniquenessScope)
+func NewPostgresURLRepository(ctx context.Context, connectionString string, scope UniquenessScope, migrateScope bool) (*postgresURLRepository, error) {
 	db, err := sqlx.Open("pgx", connectionString)
 	if err != nil {
 		return nil, err
@@ -31,7 +50,11 @@ func NewPostgresURLRepository(ctx context.Context, connectionString string) (*po
 		return nil, err
 	}
 
-	if err = prepareStatements(db); err != nil {
+	if err = migrateUniquenessScope(ctx, db, scope, migrateScope); err != nil {
+		return nil, err
+	}
+
+	if err = prepareStatements(db, scope); err != nil {
 		return nil, err
 	}
 
@@ -39,34 +62,142 @@ func NewPostgresURLRepository(ctx context.Context, connectionString string) (*po
 }
 
 //goland:noinspection SqlNoDataSourceInspection,SqlResolve
-func prepareStatements(db *sqlx.DB) error {
+func prepareStatements(db *sqlx.DB, scope UniquenessScope) error {
 	var err error
+	// если вставка не произошла - ищем уже сохраненную ссылку в рамках области уникальности
+	existingURLCondition := map[UniquenessScope]string{
+		GlobalUniqueness: `original_url = :original_url`,
+		UserUniqueness:   `original_url = :original_url AND user_id = :user_id`,
+		NoUniqueness:     `false`,
+	}[scope]
 	if insertStmt, err = db.PrepareNamed(`
 WITH new_link AS (
-    INSERT INTO urls(url_id, original_url, user_id, deleted) VALUES (:url_id, :original_url, :user_id, :deleted)
-    ON CONFLICT(original_url) DO NOTHING
+    INSERT INTO urls(url_id, original_url, user_id, deleted, expires_at, created_at, updated_at)
+    VALUES (:url_id, :original_url, :user_id, :deleted, :expires_at, :created_at, :updated_at)
+    ON CONFLICT DO NOTHING
     RETURNING url_id
 ) SELECT COALESCE(
     (SELECT url_id FROM new_link),
-    (SELECT url_id FROM urls WHERE original_url = :original_url)
+    (SELECT url_id FROM urls WHERE ` + existingURLCondition + `),
+    ''
+)
+`); err != nil {
+		return err
+	}
+
+	// истекшая ссылка не занимает оригинальную ссылку: при сохранении или изменении другой ссылки с той же оригинальной ссылкой истекшая удаляется
+	if deleteExpiredURLStmt, err = db.PrepareNamed(`DELETE FROM urls WHERE ` + existingURLCondition + ` AND url_id <> :url_id AND expires_at <= now()`); err != nil {
+		return err
+	}
+
+	if getByURLIDStmt, err = db.Preparex(`select url_id, original_url, user_id, deleted, expires_at, created_at, updated_at, deleted_at from urls where url_id = $1`); err != nil {
+		return err
+	}
+
+	if selectByUserIDStmt, err = db.Preparex(`select url_id, original_url, user_id, deleted, expires_at, created_at, updated_at, deleted_at from urls where user_id=$1 order by id`); err != nil {
+		return err
+	}
+
+	// $2 - курсор (id последней ссылки предыдущей страницы, 0 - с начала), $3 - подстрока оригинальной ссылки, $4 - размер страницы
+	pageCondition := `user_id = $1 and ($3 = '' or strpos(original_url, $3) > 0)`
+	if selectPageAscStmt, err = db.Preparex(`
+select id, url_id, original_url, user_id, deleted, expires_at, created_at, updated_at, deleted_at from urls
+where ` + pageCondition + ` and id > $2
+order by id
+limit $4`); err != nil {
+		return err
+	}
+	if selectPageDescStmt, err = db.Preparex(`
+select id, url_id, original_url, user_id, deleted, expires_at, created_at, updated_at, deleted_at from urls
+where ` + pageCondition + ` and ($2 = 0 or id < $2)
+order by id desc
+limit $4`); err != nil {
+		return err
+	}
+
+	if selectForUpdateStmt, err = db.Preparex(`select url_id, original_url, user_id, deleted, expires_at, created_at, updated_at, deleted_at from urls where url_id = $1 and user_id = $2 and not deleted for update`); err != nil {
+		return err
+	}
+
+	// аналогично вставке: если новая оригинальная ссылка уже сохранена под другим идентификатором - обновление не выполняется и возвращается ее идентификатор
+	if updateOriginalURLStmt, err = db.PrepareNamed(`
+WITH existing AS (
+    SELECT url_id FROM urls WHERE ` + existingURLCondition + ` AND url_id <> :url_id LIMIT 1
+), updated AS (
+    UPDATE urls SET original_url = :original_url, updated_at = :updated_at
+    WHERE url_id = :url_id AND NOT EXISTS (SELECT 1 FROM existing)
+    RETURNING url_id
+) SELECT COALESCE(
+    (SELECT url_id FROM updated),
+    (SELECT url_id FROM existing),
+    ''
 )
 `); err != nil {
 		return err
 	}
 
-	if getByURLIDStmt, err = db.Preparex(`select url_id, original_url, user_id, deleted  from urls where url_id = $1`); err != nil {
+	// повторное удаление не меняет время удаления, но ссылка попадает в результат
+	if batchDeleteStmt, err = db.Preparex(`
+update urls set
+    deleted = true,
+    deleted_at = case when deleted then deleted_at else now() end,
+    updated_at = case when deleted then updated_at else now() end
+where user_id = $1 and url_id = any($2)
+returning url_id`); err != nil {
+		return err
+	}
+
+	if batchRestoreStmt, err = db.Preparex(`update urls set deleted=false, deleted_at=null, updated_at=now() where user_id=$1 and url_id = any($2) and deleted`); err != nil {
+		return err
+	}
+
+	if purgeExpiredStmt, err = db.Preparex(`delete from urls where expires_at <= $1`); err != nil {
+		return err
+	}
+
+	if purgeDeletedStmt, err = db.Preparex(`delete from urls where deleted and deleted_at < $1`); err != nil {
+		return err
+	}
+
+	if nextSequenceValueStmt, err = db.Preparex(`select nextval('url_id_seq')`); err != nil {
 		return err
 	}
 
-	if selectByUserIDStmt, err = db.Preparex(`select url_id, original_url, user_id, deleted  from urls where user_id=$1`); err != nil {
+	if enqueueDeletionStmt, err = db.Preparex(`insert into delete_queue(id, user_id, url_ids, created_at) values ($1, $2, $3, $4)`); err != nil {
 		return err
 	}
 
-	if batchInsertStmt, err = db.PrepareNamed(`INSERT INTO urls(url_id, original_url, user_id, deleted) VALUES (:url_id, :original_url, :user_id, :deleted)`); err != nil {
+	if pendingDeletionsStmt, err = db.Preparex(`select id, user_id, url_ids, created_at from delete_queue order by created_at, id`); err != nil {
 		return err
 	}
 
-	if batchDeleteStmt, err = db.Preparex(`update urls set deleted=true where user_id=$1 and url_id = any($2)`); err != nil {
+	if completeDeletionsStmt, err = db.Preparex(`delete from delete_queue where id = any($1)`); err != nil {
+		return err
+	}
+
+	// из запросов пользователя, содержащих хотя бы одну из ссылок, ссылки убираются с сохранением порядка остальных
+	if cancelDeletionsStmt, err = db.Preparex(`
+		update delete_queue
+		set url_ids = (
+			select coalesce(jsonb_agg(url_id order by idx), '[]'::jsonb)
+			from jsonb_array_elements_text(url_ids) with ordinality as ids(url_id, idx)
+			where url_id <> all($2)
+		)
+		where user_id = $1 and url_ids ?| $2`); err != nil {
+		return err
+	}
+
+	if insertClickStmt, err = db.PrepareNamed(`INSERT INTO clicks(url_id, clicked_at, referrer, user_agent) VALUES (:url_id, :clicked_at, :referrer, :user_agent)`); err != nil {
+		return err
+	}
+
+	if selectDailyClicksStmt, err = db.Preparex(`
+select date_trunc('day', clicked_at AT TIME ZONE 'UTC') as day, count(*) as clicks
+from clicks
+where url_id = $1
+group by day
+order by day
+`); err != nil {
 		return err
 	}
 
@@ -74,42 +205,80 @@ WITH new_link AS (
 }
 
 func (s *postgresURLRepository) Store(ctx context.Context, urlEntity URLEntity) error {
-	row := insertStmt.QueryRowContext(ctx, &urlEntity)
-	var urlID string
-	err := row.Scan(&urlID)
+	urlEntity = urlEntity.created(time.Now().UTC())
+	urlID, err := insertURL(ctx, insertStmt, deleteExpiredURLStmt, urlEntity)
 	if err != nil {
 		return err
 	}
 	// Можно было бы использовать более простой запрос на вставку, ловить ошибку, анализировать ее на нарушение конкретного констрейнта
 	// Но тогда нужно было бы делать дополнительный запрос в БД для получения идентификатора конфликтующей записи
 	// Как лучше - большой вопрос, зависит от частоты возникновения конфликтов в реальном мире
-	if urlID != urlEntity.ID {
+	return insertResultToError(urlEntity, urlID)
+}
+
+// insertURL выполняет запрос вставки insert (см. insertResultToError). Если оригинальная ссылка занята истекшей ссылкой -
+// удаляет ее запросом deleteExpired и повторяет вставку
+func insertURL(ctx context.Context, insert *sqlx.NamedStmt, deleteExpired *sqlx.NamedStmt, urlEntity URLEntity) (string, error) {
+	var urlID string
+	if err := insert.QueryRowxContext(ctx, &urlEntity).Scan(&urlID); err != nil {
+		return "", err
+	}
+	if urlID == urlEntity.ID || urlID == "" {
+		return urlID, nil
+	}
+	res, err := deleteExpired.ExecContext(ctx, &urlEntity)
+	if err != nil {
+		return "", err
+	}
+	if deleted, err := res.RowsAffected(); err != nil || deleted == 0 {
+		return urlID, err
+	}
+	if err = insert.QueryRowxContext(ctx, &urlEntity).Scan(&urlID); err != nil {
+		return "", err
+	}
+	return urlID, nil
+}
+
+// insertResultToError интерпретирует результат запроса вставки:
+// совпадение с идентификатором сохраняемой ссылки - ссылка сохранена,
+// пустая строка - вставка не произошла, но оригинальная ссылка не найдена, значит занят идентификатор,
+// иначе - оригинальная ссылка уже сохранена под другим идентификатором
+func insertResultToError(urlEntity URLEntity, urlID string) error {
+	switch urlID {
+	case urlEntity.ID:
+		return nil
+	case "":
+		return NewErrURLIDConflict(urlEntity.ID)
+	default:
 		return NewErrURLExists(urlID)
 	}
-	return nil
 }
 
-func (s *postgresURLRepository) StoreBatch(ctx context.Context, entitiesBatch []URLEntity) error {
+func (s *postgresURLRepository) StoreBatch(ctx context.Context, entitiesBatch []URLEntity) ([]error, error) {
 	tx, err := s.DB.BeginTxx(ctx, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	//goland:noinspection GoUnhandledErrorResult
 	defer tx.Rollback() //nolint:errcheck
 
-	txInsertStmt := tx.NamedStmtContext(ctx, batchInsertStmt)
-	for _, entity := range entitiesBatch {
-		// TODO: тут нет проверки ошибки на нарушение уникальности оригинального урла и соответствующей обработки (выброса ErrURLExists)
-		// Поэтому при попытке сохранить дубликат ссылки весь батч просто упадет с ошибкой (но по ТЗ и не надо было обрабатывать).
-		// Если будет время - надо допилить.
-		if _, err = txInsertStmt.Exec(&entity); err != nil {
-			return err
+	// конфликты обрабатываются через ON CONFLICT DO NOTHING, поэтому не прерывают транзакцию
+	txInsertStmt := tx.NamedStmtContext(ctx, insertStmt)
+	txDeleteExpiredStmt := tx.NamedStmtContext(ctx, deleteExpiredURLStmt)
+	itemErrs := make([]error, len(entitiesBatch))
+	now := time.Now().UTC()
+	for idx, entity := range entitiesBatch {
+		entity = entity.created(now)
+		urlID, err := insertURL(ctx, txInsertStmt, txDeleteExpiredStmt, entity)
+		if err != nil {
+			return nil, err
 		}
+		itemErrs[idx] = insertResultToError(entity, urlID)
 	}
 	if err = tx.Commit(); err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	return itemErrs, nil
 }
 
 func (s *postgresURLRepository) Load(ctx context.Context, key string) (URLEntity, error) {
@@ -132,18 +301,203 @@ func (s *postgresURLRepository) LoadByUserID(ctx context.Context, userID string)
 	return result, nil
 }
 
+// LoadPageByUserID implements URLRepository.LoadPageByUserID
+// Порядок создания - порядок id, курсор - id последней ссылки страницы
+func (s *postgresURLRepository) LoadPageByUserID(ctx context.Context, query URLPageQuery) (URLPage, error) {
+	cursor, err := decodeCursor(query.Cursor)
+	if err != nil {
+		return URLPage{}, err
+	}
+	if cursor > math.MaxInt64 {
+		return URLPage{}, ErrInvalidCursor
+	}
+	stmt := selectPageAscStmt
+	if query.Descending {
+		stmt = selectPageDescStmt
+	}
+
+	var rows []struct {
+		Position int64 `db:"id"`
+		URLEntity
+	}
+	// запрашиваем на одну ссылку больше, чтобы понять, есть ли следующая страница
+	if err = stmt.SelectContext(ctx, &rows, query.UserID, int64(cursor), query.OriginalURLContains, query.Limit+1); err != nil {
+		return URLPage{}, err
+	}
+
+	page := URLPage{Entities: make([]URLEntity, 0, query.Limit)}
+	for idx, row := range rows {
+		if idx == query.Limit {
+			page.NextCursor = encodeCursor(uint64(rows[idx-1].Position))
+			break
+		}
+		page.Entities = append(page.Entities, row.URLEntity)
+	}
+	return page, nil
+}
+
+// UpdateOriginalURL implements URLRepository.UpdateOriginalURL
+func (s *postgresURLRepository) UpdateOriginalURL(ctx context.Context, userID string, id string, originalURL string) (URLEntity, error) {
+	tx, err := s.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return URLEntity{}, err
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer tx.Rollback() //nolint:errcheck
+
+	var entity URLEntity
+	if err = tx.StmtxContext(ctx, selectForUpdateStmt).GetContext(ctx, &entity, id, userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return URLEntity{}, ErrURLNotFound
+		}
+		return URLEntity{}, err
+	}
+	if entity.OriginalURL == originalURL {
+		return entity, nil
+	}
+
+	entity.OriginalURL = originalURL
+	entity.UpdatedAt = time.Now().UTC()
+	if _, err = tx.NamedStmtContext(ctx, deleteExpiredURLStmt).ExecContext(ctx, &entity); err != nil {
+		return URLEntity{}, err
+	}
+	var urlID string
+	if err = tx.NamedStmtContext(ctx, updateOriginalURLStmt).QueryRowxContext(ctx, &entity).Scan(&urlID); err != nil {
+		return URLEntity{}, err
+	}
+	if urlID != entity.ID {
+		return URLEntity{}, NewErrURLExists(urlID)
+	}
+	if err = tx.Commit(); err != nil {
+		return URLEntity{}, err
+	}
+	return entity, nil
+}
+
 // DeleteURLs implements URLRepository.DeleteURLs
-func (s *postgresURLRepository) DeleteURLs(ctx context.Context, userID string, ids []string) error {
-	if _, err := batchDeleteStmt.ExecContext(ctx, userID, ids); err != nil {
+func (s *postgresURLRepository) DeleteURLs(ctx context.Context, userID string, ids []string) ([]string, error) {
+	deleted := make([]string, 0, len(ids))
+	if err := batchDeleteStmt.SelectContext(ctx, &deleted, userID, ids); err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
+// RestoreURLs implements URLRepository.RestoreURLs
+func (s *postgresURLRepository) RestoreURLs(ctx context.Context, userID string, ids []string) error {
+	if _, err := batchRestoreStmt.ExecContext(ctx, userID, ids); err != nil {
+		return err
+	}
+	return nil
+}
+
+// PurgeExpired implements URLRepository.PurgeExpired
+func (s *postgresURLRepository) PurgeExpired(ctx context.Context, before time.Time) (int, error) {
+	return execPurge(ctx, purgeExpiredStmt, before)
+}
+
+// PurgeDeleted implements URLRepository.PurgeDeleted
+// Статистика переходов по удаляемым ссылкам удаляется каскадно
+func (s *postgresURLRepository) PurgeDeleted(ctx context.Context, before time.Time) (int, error) {
+	return execPurge(ctx, purgeDeletedStmt, before)
+}
+
+func execPurge(ctx context.Context, stmt *sqlx.Stmt, before time.Time) (int, error) {
+	res, err := stmt.ExecContext(ctx, before)
+	if err != nil {
+		return 0, err
+	}
+	purged, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(purged), nil
+}
+
+// RecordClick implements ClickRepository.RecordClick
+func (s *postgresURLRepository) RecordClick(ctx context.Context, click Click) error {
+	if _, err := insertClickStmt.ExecContext(ctx, &click); err != nil {
 		return err
 	}
 	return nil
 }
 
+// LoadStats implements ClickRepository.LoadStats
+func (s *postgresURLRepository) LoadStats(ctx context.Context, urlID string) (URLStats, error) {
+	var daily []DailyClicks
+	if err := selectDailyClicksStmt.SelectContext(ctx, &daily, urlID); err != nil {
+		return URLStats{}, err
+	}
+	stats := URLStats{Daily: make([]DailyClicks, len(daily))}
+	for idx, d := range daily {
+		// date_trunc от timestamp without time zone возвращает время без зоны, приводим к UTC явно
+		stats.Daily[idx] = DailyClicks{Date: truncateToDay(d.Date), Count: d.Count}
+		stats.Total += d.Count
+	}
+	return stats, nil
+}
+
+// NextSequenceValue implements SequenceRepository.NextSequenceValue
+func (s *postgresURLRepository) NextSequenceValue(ctx context.Context) (uint64, error) {
+	var value int64
+	if err := nextSequenceValueStmt.QueryRowxContext(ctx).Scan(&value); err != nil {
+		return 0, err
+	}
+	return uint64(value), nil
+}
+
+// EnqueueDeletion implements DeletionQueueRepository.EnqueueDeletion
+func (s *postgresURLRepository) EnqueueDeletion(ctx context.Context, req DeletionRequest) error {
+	urlIDs, err := json.Marshal(req.URLIDs)
+	if err != nil {
+		return err
+	}
+	_, err = enqueueDeletionStmt.ExecContext(ctx, req.ID, req.UserID, string(urlIDs), req.CreatedAt)
+	return err
+}
+
+// PendingDeletions implements DeletionQueueRepository.PendingDeletions
+func (s *postgresURLRepository) PendingDeletions(ctx context.Context) ([]DeletionRequest, error) {
+	var rows []struct {
+		ID        string    `db:"id"`
+		UserID    string    `db:"user_id"`
+		URLIDs    string    `db:"url_ids"`
+		CreatedAt time.Time `db:"created_at"`
+	}
+	if err := pendingDeletionsStmt.SelectContext(ctx, &rows); err != nil {
+		return nil, err
+	}
+	pending := make([]DeletionRequest, len(rows))
+	for idx, row := range rows {
+		pending[idx] = DeletionRequest{ID: row.ID, UserID: row.UserID, CreatedAt: row.CreatedAt}
+		if err := json.Unmarshal([]byte(row.URLIDs), &pending[idx].URLIDs); err != nil {
+			return nil, fmt.Errorf("error while parsing deletion request urls; %w", err)
+		}
+	}
+	return pending, nil
+}
+
+// CompleteDeletions implements DeletionQueueRepository.CompleteDeletions
+func (s *postgresURLRepository) CompleteDeletions(ctx context.Context, ids []string) error {
+	_, err := completeDeletionsStmt.ExecContext(ctx, ids)
+	return err
+}
+
+// CancelDeletions implements DeletionQueueRepository.CancelDeletions
+func (s *postgresURLRepository) CancelDeletions(ctx context.Context, userID string, urlIDs []string) error {
+	_, err := cancelDeletionsStmt.ExecContext(ctx, userID, urlIDs)
+	return err
+}
+
 func (s *postgresURLRepository) Ping(ctx context.Context) error {
 	return s.DB.PingContext(ctx)
 }
 
+// Close implements URLRepository.Close
+func (s *postgresURLRepository) Close() error {
+	return s.DB.Close()
+}
+
 func createTables(ctx context.Context, db *sqlx.DB) error {
 	//goland:noinspection SqlNoDataSourceInspection
 	createScript := `
@@ -154,13 +508,176 @@ func createTables(ctx context.Context, db *sqlx.DB) error {
 		original_url character varying  NOT NULL,
 		user_id character varying NOT NULL,
 		deleted boolean NOT NULL DEFAULT false,
+		expires_at timestamp with time zone,
+		created_at timestamp with time zone NOT NULL DEFAULT now(),
+		updated_at timestamp with time zone NOT NULL DEFAULT now(),
+		deleted_at timestamp with time zone,
 		CONSTRAINT urls_pkey PRIMARY KEY (id),
-		CONSTRAINT url_id_unique UNIQUE (url_id),
-		CONSTRAINT original_url_unique UNIQUE (original_url)
-	)
+		CONSTRAINT url_id_unique UNIQUE (url_id)
+	);
+	ALTER TABLE urls ADD COLUMN IF NOT EXISTS expires_at timestamp with time zone;
+	ALTER TABLE urls ADD COLUMN IF NOT EXISTS created_at timestamp with time zone NOT NULL DEFAULT now();
+	ALTER TABLE urls ADD COLUMN IF NOT EXISTS updated_at timestamp with time zone NOT NULL DEFAULT now();
+	ALTER TABLE urls ADD COLUMN IF NOT EXISTS deleted_at timestamp with time zone;
+	-- ссылки, удаленные до появления времени удаления, считаются удаленными в момент обновления схемы, чтобы срок хранения отсчитывался от него
+	UPDATE urls SET deleted_at = now() WHERE deleted AND deleted_at IS NULL;
+	CREATE INDEX IF NOT EXISTS urls_user_id_idx ON urls (user_id, id);
+	CREATE INDEX IF NOT EXISTS urls_expires_at_idx ON urls (expires_at) WHERE expires_at IS NOT NULL;
+	CREATE INDEX IF NOT EXISTS urls_deleted_at_idx ON urls (deleted_at) WHERE deleted;
+	CREATE TABLE IF NOT EXISTS clicks
+	(
+		id bigint NOT NULL GENERATED ALWAYS AS IDENTITY,
+		url_id character varying NOT NULL,
+		clicked_at timestamp with time zone NOT NULL,
+		referrer character varying NOT NULL DEFAULT '',
+		user_agent character varying NOT NULL DEFAULT '',
+		CONSTRAINT clicks_pkey PRIMARY KEY (id),
+		CONSTRAINT clicks_url_id_fkey FOREIGN KEY (url_id) REFERENCES urls (url_id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS clicks_url_id_idx ON clicks (url_id);
+	CREATE SEQUENCE IF NOT EXISTS url_id_seq AS bigint;
+	CREATE TABLE IF NOT EXISTS schema_settings
+	(
+		name character varying NOT NULL,
+		value character varying NOT NULL,
+		CONSTRAINT schema_settings_pkey PRIMARY KEY (name)
+	);
+	CREATE TABLE IF NOT EXISTS delete_queue
+	(
+		id character varying NOT NULL,
+		user_id character varying NOT NULL,
+		url_ids jsonb NOT NULL,
+		created_at timestamp with time zone NOT NULL,
+		CONSTRAINT delete_queue_pkey PRIMARY KEY (id)
+	);
 	`
 	innerCtx, cancel := context.WithTimeout(ctx, time.Second*5)
 	defer cancel()
 	_, err := db.ExecContext(innerCtx, createScript)
 	return err
 }
+
+// uniquenessConstraints ограничения уникальности оригинальных ссылок по областям уникальности. У NoUniqueness ограничения нет
+var uniquenessConstraints = map[UniquenessScope]struct {
+	name    string
+	columns string
+}{
+	GlobalUniqueness: {name: "original_url_unique", columns: "original_url"},
+	UserUniqueness:   {name: "user_original_url_unique", columns: "user_id, original_url"},
+}
+
+// uniquenessScopeLockKey ключ advisory-блокировки, чтобы экземпляры сервиса, запускаемые одновременно, не меняли ограничения параллельно
+const uniquenessScopeLockKey = 20090
+
+// migrateUniquenessScope сверяет область уникальности, записанную в БД, с заданной scope.
+// Ограничения уникальности общие для всех экземпляров сервиса, поэтому меняются только при явном разрешении migrate
+// (или в пустой БД), один раз: дальше область уникальности в БД совпадает с заданной и ограничения не трогаются
+//
+//goland:noinspection SqlNoDataSourceInspection,SqlResolve
+func migrateUniquenessScope(ctx context.Context, db *sqlx.DB, scope UniquenessScope, migrate bool) error {
+	innerCtx, cancel := context.WithTimeout(ctx, time.Second*30)
+	defer cancel()
+	tx, err := db.BeginTxx(innerCtx, nil)
+	if err != nil {
+		return err
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer tx.Rollback() //nolint:errcheck
+
+	if _, err = tx.ExecContext(innerCtx, `select pg_advisory_xact_lock($1)`, uniquenessScopeLockKey); err != nil {
+		return err
+	}
+	current, recorded, err := currentUniquenessScope(innerCtx, tx)
+	if err != nil {
+		return err
+	}
+	if current == scope && recorded {
+		return nil
+	}
+	if current != scope && current != "" && !migrate {
+		return fmt.Errorf("url uniqueness scope in database is %s, configured %s; set -migrate-url-uniqueness-scope to change it", current, scope)
+	}
+
+	if current != scope {
+		for otherScope, constraint := range uniquenessConstraints {
+			if otherScope == scope {
+				continue
+			}
+			if _, err = tx.ExecContext(innerCtx, `ALTER TABLE urls DROP CONSTRAINT IF EXISTS `+constraint.name); err != nil {
+				return err
+			}
+		}
+		if constraint, ok := uniquenessConstraints[scope]; ok {
+			if err = addUniquenessConstraint(innerCtx, tx, scope, constraint.name, constraint.columns); err != nil {
+				return err
+			}
+		}
+		log.Info().Str("from", string(current)).Str("to", string(scope)).Msg("url uniqueness scope migrated")
+	}
+
+	if _, err = tx.ExecContext(innerCtx, `
+INSERT INTO schema_settings(name, value) VALUES ('url_uniqueness_scope', $1)
+ON CONFLICT (name) DO UPDATE SET value = excluded.value`, string(scope)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// currentUniquenessScope возвращает область уникальности, записанную в БД (recorded = true).
+// БД, созданные до записи области уникальности, определяются по ограничениям: пустая таблица ссылок - пустая строка (область не задана)
+//
+//goland:noinspection SqlNoDataSourceInspection,SqlResolve
+func currentUniquenessScope(ctx context.Context, tx *sqlx.Tx) (scope UniquenessScope, recorded bool, err error) {
+	var value string
+	err = tx.GetContext(ctx, &value, `SELECT value FROM schema_settings WHERE name = 'url_uniqueness_scope'`)
+	if err == nil {
+		scope, err = ParseUniquenessScope(value)
+		return scope, true, err
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return "", false, err
+	}
+
+	var hasURLs bool
+	if err = tx.GetContext(ctx, &hasURLs, `SELECT EXISTS (SELECT 1 FROM urls)`); err != nil || !hasURLs {
+		return "", false, err
+	}
+	for _, candidate := range []UniquenessScope{GlobalUniqueness, UserUniqueness} {
+		var exists bool
+		if err = tx.GetContext(ctx, &exists, `SELECT EXISTS (SELECT 1 FROM pg_constraint WHERE conrelid = 'urls'::regclass AND conname = $1)`,
+			uniquenessConstraints[candidate].name); err != nil {
+			return "", false, err
+		}
+		if exists {
+			return candidate, false, nil
+		}
+	}
+	return NoUniqueness, false, nil
+}
+
+// addUniquenessConstraint добавляет ограничение уникальности области scope, если его еще нет.
+// Если ссылки уже нарушают ограничение - возвращает ошибку с первой из повторяющихся оригинальных ссылок
+//
+//goland:noinspection SqlNoDataSourceInspection,SqlResolve
+func addUniquenessConstraint(ctx context.Context, tx *sqlx.Tx, scope UniquenessScope, name string, columns string) error {
+	var exists bool
+	if err := tx.GetContext(ctx, &exists, `SELECT EXISTS (SELECT 1 FROM pg_constraint WHERE conrelid = 'urls'::regclass AND conname = $1)`, name); err != nil || exists {
+		return err
+	}
+
+	var duplicate struct {
+		OriginalURL string `db:"original_url"`
+		Count       int    `db:"count"`
+	}
+	err := tx.GetContext(ctx, &duplicate, `SELECT original_url, count(*) AS count FROM urls GROUP BY `+columns+` HAVING count(*) > 1 LIMIT 1`)
+	if err == nil {
+		return fmt.Errorf("can not change url uniqueness scope to %s: original url %q is shortened %d times within the scope, remove duplicates first",
+			scope, duplicate.OriginalURL, duplicate.Count)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `ALTER TABLE urls ADD CONSTRAINT `+name+` UNIQUE (`+columns+`)`)
+	return err
+}
@@ -0,0 +1,12 @@
+package repository
+
+import "context"
+
+// SequenceRepository представляет интерфейс хранимого монотонно возрастающего счетчика
+type SequenceRepository interface {
+	// NextSequenceValue возвращает следующее значение счетчика. Значения не повторяются, в том числе после перезапуска сервиса, но могут идти с пропусками
+	NextSequenceValue(ctx context.Context) (uint64, error)
+}
+
+// sequenceReserveBlock сколько значений счетчика резервируется за одну запись в файл хранилища в памяти
+const sequenceReserveBlock = 100
@@ -0,0 +1,25 @@
+package repository
+
+import "fmt"
+
+// UniquenessScope область уникальности оригинальных ссылок
+type UniquenessScope string
+
+const (
+	// GlobalUniqueness оригинальная ссылка может быть сокращена только один раз
+	GlobalUniqueness UniquenessScope = "global"
+	// UserUniqueness каждый пользователь может сократить оригинальную ссылку один раз
+	UserUniqueness UniquenessScope = "user"
+	// NoUniqueness оригинальная ссылка может быть сокращена сколько угодно раз
+	NoUniqueness UniquenessScope = "none"
+)
+
+// ParseUniquenessScope возвращает область уникальности по ее строковому представлению
+func ParseUniquenessScope(s string) (UniquenessScope, error) {
+	switch scope := UniquenessScope(s); scope {
+	case GlobalUniqueness, UserUniqueness, NoUniqueness:
+		return scope, nil
+	default:
+		return "", fmt.Errorf("unknown url uniqueness scope: %s", s)
+	}
+}
@@ -1,8 +1,53 @@
 package repository
 
+import "time"
+
 type URLEntity struct {
-	ID          string `db:"url_id"`
-	OriginalURL string `db:"original_url"`
-	UserID      string `db:"user_id"`
-	Deleted     bool   `db:"deleted"`
+	ID          string     `db:"url_id"`
+	OriginalURL string     `db:"original_url"`
+	UserID      string     `db:"user_id"`
+	Deleted     bool       `db:"deleted"`
+	ExpiresAt   *time.Time `db:"expires_at"`
+	// CreatedAt и UpdatedAt проставляются хранилищем. У ссылок, сохраненных до появления этих полей в файловом хранилище, - нулевые
+	CreatedAt time.Time  `db:"created_at"`
+	UpdatedAt time.Time  `db:"updated_at"`
+	DeletedAt *time.Time `db:"deleted_at"`
+}
+
+// IsExpired возвращает true, если у ссылки задан срок действия и он истек к моменту now
+func (e URLEntity) IsExpired(now time.Time) bool {
+	return e.ExpiresAt != nil && !e.ExpiresAt.After(now)
+}
+
+// IsDeletedBefore возвращает true, если ссылка помечена удаленной до момента before.
+// Ссылки без времени удаления не подходят: хранилища проставляют его при загрузке, см. NewInMemoryRepository и createTables
+func (e URLEntity) IsDeletedBefore(before time.Time) bool {
+	return e.Deleted && e.DeletedAt != nil && e.DeletedAt.Before(before)
+}
+
+// created проставляет время создания новой ссылки, если оно не задано
+func (e URLEntity) created(now time.Time) URLEntity {
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = now
+	}
+	if e.UpdatedAt.IsZero() {
+		e.UpdatedAt = e.CreatedAt
+	}
+	return e
+}
+
+// markDeleted помечает ссылку удаленной в момент now
+func (e URLEntity) markDeleted(now time.Time) URLEntity {
+	e.Deleted = true
+	e.DeletedAt = &now
+	e.UpdatedAt = now
+	return e
+}
+
+// restored снимает пометку удаления со ссылки в момент now
+func (e URLEntity) restored(now time.Time) URLEntity {
+	e.Deleted = false
+	e.DeletedAt = nil
+	e.UpdatedAt = now
+	return e
 }
@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"strconv"
+	"strings"
+)
+
+// URLPageQuery параметры постраничной выборки ссылок пользователя
+type URLPageQuery struct {
+	UserID string
+	// Limit максимальное количество ссылок на странице
+	Limit int
+	// Cursor позиция, после которой начинается страница (URLPage.NextCursor предыдущей страницы). Пустое значение - с начала
+	Cursor string
+	// Descending порядок от новых ссылок к старым. По умолчанию - в порядке создания
+	Descending bool
+	// OriginalURLContains если не пусто - выбираются только ссылки, оригинальная ссылка которых содержит эту подстроку
+	OriginalURLContains string
+}
+
+// URLPage страница ссылок пользователя
+type URLPage struct {
+	Entities []URLEntity
+	// NextCursor курсор следующей страницы. Пустое значение - страница последняя
+	NextCursor string
+}
+
+// encodeCursor курсор - порядковый номер создания последней ссылки страницы. Для клиента значение непрозрачно
+func encodeCursor(position uint64) string {
+	return strconv.FormatUint(position, 36)
+}
+
+func decodeCursor(cursor string) (uint64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	position, err := strconv.ParseUint(cursor, 36, 64)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	return position, nil
+}
+
+func matchesPageQuery(entity URLEntity, query URLPageQuery) bool {
+	return query.OriginalURLContains == "" || strings.Contains(entity.OriginalURL, query.OriginalURLContains)
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/config"
+	"time"
 )
 
 //goland:noinspection GoNameStartsWithPackageName
@@ -17,24 +18,47 @@ const (
 type URLRepository interface {
 	// Store сохраняет ссылку в хранилище
 	Store(ctx context.Context, urlEntity URLEntity) error
-	// StoreBatch сохраняет список сокращенных ссылок
-	StoreBatch(ctx context.Context, entitiesBatch []URLEntity) error
+	// StoreBatch сохраняет список сокращенных ссылок. Ссылки сохраняются независимо друг от друга:
+	// результат сохранения каждой ссылки возвращается в срезе по тому же индексу (nil, ErrURLExists или ErrURLIDConflict).
+	// Ошибка возвращается, если не удалось сохранить пакет целиком
+	StoreBatch(ctx context.Context, entitiesBatch []URLEntity) ([]error, error)
 	// Load возвращает сохраненную ссылку по идентификатору. Возвращает сущность ссылки, если она найдена, в противном случае ErrURLNotFound
 	Load(ctx context.Context, key string) (URLEntity, error)
 	// LoadByUserID возвращает все ссылки созданные юзером
 	LoadByUserID(ctx context.Context, userID string) ([]URLEntity, error)
-	// DeleteURLs помечает ссылки удаленными
-	DeleteURLs(ctx context.Context, userID string, ids []string) error
+	// LoadPageByUserID возвращает страницу ссылок пользователя в порядке создания (или обратном).
+	// Возвращает ErrInvalidCursor, если курсор не получен из предыдущей страницы
+	LoadPageByUserID(ctx context.Context, query URLPageQuery) (URLPage, error)
+	// UpdateOriginalURL меняет оригинальную ссылку у ссылки пользователя и возвращает обновленную ссылку.
+	// Возвращает ErrURLNotFound, если ссылка не найдена, удалена или создана другим пользователем,
+	// ErrURLExists - если новая оригинальная ссылка уже сокращена (в рамках области уникальности)
+	UpdateOriginalURL(ctx context.Context, userID string, id string, originalURL string) (URLEntity, error)
+	// DeleteURLs помечает удаленными ссылки пользователя userID. Чужие и несуществующие ссылки пропускаются.
+	// Возвращает идентификаторы ссылок пользователя, которые после вызова помечены удаленными (в том числе удаленные ранее)
+	DeleteURLs(ctx context.Context, userID string, ids []string) ([]string, error)
+	// RestoreURLs снимает пометку удаления со ссылок пользователя. Чужие, неудаленные и несуществующие ссылки пропускаются
+	RestoreURLs(ctx context.Context, userID string, ids []string) error
+	// PurgeExpired окончательно удаляет ссылки, срок действия которых истек до момента before. Возвращает количество удаленных ссылок
+	PurgeExpired(ctx context.Context, before time.Time) (int, error)
+	// PurgeDeleted окончательно удаляет ссылки, помеченные удаленными до момента before. Ссылкам, удаленным до того, как хранилище начало записывать время удаления,
+	// время удаления проставляется при загрузке, поэтому срок хранения для них отсчитывается от нее.
+	// Возвращает количество удаленных ссылок
+	PurgeDeleted(ctx context.Context, before time.Time) (int, error)
 	// Ping возвращает статус хранилища
 	Ping(ctx context.Context) error
+	// Close сбрасывает несохраненные данные и освобождает ресурсы хранилища. После Close хранилище не используется
+	Close() error
 }
 
 func NewRepository(ctx context.Context, cfg config.Config) (URLRepository, error) {
 	var repo URLRepository
-	var err error
+	scope, err := ParseUniquenessScope(cfg.URLUniquenessScope)
+	if err != nil {
+		return nil, err
+	}
 	switch getRepositoryType(cfg) {
 	case InMemoryRepository:
-		var options []InMemoryRepositoryOption
+		options := []InMemoryRepositoryOption{WithUniquenessScope(scope)}
 		if cfg.StorageFilePath != "" {
 			options = append(options, WithFilePersistance(cfg.StorageFilePath))
 		}
@@ -43,7 +67,7 @@ func NewRepository(ctx context.Context, cfg config.Config) (URLRepository, error
 			return nil, err
 		}
 	case DatabaseRepository:
-		repo, err = NewPostgresURLRepository(ctx, cfg.DatabaseDSN)
+		repo, err = NewPostgresURLRepository(ctx, cfg.DatabaseDSN, scope, cfg.MigrateURLUniquenessScope)
 		if err != nil {
 			return nil, err
 		}
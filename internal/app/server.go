@@ -1,17 +1,130 @@
 package app
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
 	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/config"
 	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/handlers"
 	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/repository"
 	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/shortener"
-	"log"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/tlscert"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
-//StartURLShortenerServer старт нового сервера сокращения ссылок
-func StartURLShortenerServer(cfg config.Config, repo repository.URLRepository, idGenerator shortener.URLIDGenerator) {
+//StartURLShortenerServer старт нового сервера сокращения ссылок. Работает до SIGINT/SIGTERM, после чего корректно останавливается:
+//перестает принимать соединения, дожидается обработки начатых запросов, выполняет накопленные запросы на удаление ссылок
+//и закрывает хранилище. На всю остановку отводится ShutdownTimeout
+func StartURLShortenerServer(cfg config.Config, repo repository.URLRepository, idGenerator shortener.URLIDGenerator) error {
+	var tlsConfig *tls.Config
+	if cfg.EnableHTTPS {
+		cert, err := tlscert.LoadOrCreate(cfg.TLSCertFile, cfg.TLSKeyFile, certificateHosts(cfg))
+		if err != nil {
+			return err
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	}
+
 	service := handlers.NewService(repo, idGenerator, cfg)
 	r := handlers.NewRouter(service)
-	log.Fatal(http.ListenAndServe(cfg.ServerAddress, r))
+	srv := &http.Server{Addr: cfg.ServerAddress, Handler: r, TLSConfig: tlsConfig}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if cfg.EnableHTTPS {
+			// сертификат уже в srv.TLSConfig
+			serveErr <- srv.ListenAndServeTLS("", "")
+			return
+		}
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	defer signal.Stop(reload)
+
+	var err error
+	running := true
+	for running {
+		select {
+		case err = <-serveErr:
+			log.Error().Err(err).Msg("server stopped unexpectedly")
+			running = false
+		case <-ctx.Done():
+			log.Info().Msg("shutting down server")
+			running = false
+		case <-reload:
+			reloadConfig(service)
+		}
+	}
+	// повторный сигнал прерывает остановку
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if shutdownErr := srv.Shutdown(shutdownCtx); shutdownErr != nil {
+		log.Error().Err(shutdownErr).Msg("error while shutting down http server")
+	}
+	if shutdownErr := service.Shutdown(shutdownCtx); shutdownErr != nil {
+		log.Error().Err(shutdownErr).Msg("background tasks were not finished before shutdown timeout")
+	}
+	if closeErr := repo.Close(); closeErr != nil {
+		log.Error().Err(closeErr).Msg("error while closing repository")
+		if err == nil {
+			err = closeErr
+		}
+	}
+	log.Info().Msg("server stopped")
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// reloadConfig перечитывает конфигурацию и применяет к работающему сервису. Если новая конфигурация недопустима
+// или в ней изменились настройки, требующие перезапуска, - сервис продолжает работать со старой
+func reloadConfig(service *handlers.Service) {
+	cfg, changes, err := config.Reload(service.Config())
+	if err != nil {
+		log.Error().Err(err).Msg("configuration is not reloaded")
+		return
+	}
+	if len(changes) == 0 {
+		log.Info().Msg("configuration reloaded, nothing changed")
+		return
+	}
+	for _, change := range changes {
+		log.Info().Str("field", change.Field).Interface("old", change.Old).Interface("new", change.New).Msg("configuration changed")
+	}
+	service.ApplyConfig(cfg)
+	SetLogLevel(cfg.LogLevel)
+}
+
+// SetLogLevel устанавливает уровень логирования. Уровень уже проверен при разборе конфигурации
+func SetLogLevel(level string) {
+	parsed, err := zerolog.ParseLevel(level)
+	if err != nil {
+		log.Error().Err(err).Msg("unknown log level")
+		return
+	}
+	zerolog.SetGlobalLevel(parsed)
+}
+
+// certificateHosts имена и адреса, для которых генерируется самоподписанный сертификат: локальные и хост из BaseURL
+func certificateHosts(cfg config.Config) []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if u, err := url.Parse(cfg.BaseURL); err == nil && u.Hostname() != "" && u.Hostname() != "localhost" {
+		hosts = append(hosts, u.Hostname())
+	}
+	return hosts
 }
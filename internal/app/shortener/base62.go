@@ -0,0 +1,18 @@
+package shortener
+
+const base62Alphabet = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// encodeBase62 кодирует число в строку из цифр и латинских букв
+func encodeBase62(v uint64) string {
+	if v == 0 {
+		return base62Alphabet[:1]
+	}
+	var b [11]byte // 62^11 > 2^64
+	i := len(b)
+	for v > 0 {
+		i--
+		b[i] = base62Alphabet[v%62]
+		v /= 62
+	}
+	return string(b[i:])
+}
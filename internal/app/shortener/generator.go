@@ -0,0 +1,46 @@
+package shortener
+
+import (
+	"errors"
+	"fmt"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/config"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/repository"
+)
+
+// GeneratorType тип генератора идентификаторов ссылок
+type GeneratorType string
+
+const (
+	// RandomGenerator генератор на основе math/rand
+	RandomGenerator GeneratorType = "random"
+	// SecureRandomGenerator генератор на основе crypto/rand с настраиваемым алфавитом
+	SecureRandomGenerator GeneratorType = "secure"
+	// SequentialGenerator генератор на основе хранимого в репозитории счетчика
+	SequentialGenerator GeneratorType = "sequential"
+	// HashGenerator генератор детерминированных идентификаторов на основе хеша ссылки
+	HashGenerator GeneratorType = "hash"
+)
+
+// NewURLIDGenerator создает генератор идентификаторов ссылок в соответствии с конфигурацией
+func NewURLIDGenerator(cfg config.Config, repo repository.URLRepository) (URLIDGenerator, error) {
+	switch GeneratorType(cfg.URLIDGenerator) {
+	case RandomGenerator:
+		return NewRandomStringURLIDGenerator(), nil
+	case SecureRandomGenerator:
+		return NewSecureRandomURLIDGenerator(cfg.URLIDAlphabet)
+	case SequentialGenerator:
+		sequence, ok := repo.(repository.SequenceRepository)
+		if !ok {
+			return nil, errors.New("url repository does not support sequences")
+		}
+		return NewSequentialURLIDGenerator(sequence, cfg.URLIDObfuscationKey), nil
+	case HashGenerator:
+		key := cfg.URLIDHashKey
+		if key == "" {
+			key = DeriveHashKey(cfg.AuthSecretKey)
+		}
+		return NewHashURLIDGenerator(key), nil
+	default:
+		return nil, fmt.Errorf("unknown url id generator type: %s", cfg.URLIDGenerator)
+	}
+}
@@ -0,0 +1,74 @@
+package shortener
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"math/big"
+	"net/url"
+	"strings"
+)
+
+// HashURLIDGenerator генерирует идентификатор как усеченный base62-код HMAC-SHA256 от нормализованной ссылки.
+// Одна и та же ссылка всегда получает один и тот же идентификатор. При коллизии усечения выход - запросить идентификатор большей длины.
+// Ссылки нужно сохранять нормализованными (см. URLNormalizer)
+type HashURLIDGenerator struct {
+	key []byte
+}
+
+func NewHashURLIDGenerator(key string) *HashURLIDGenerator {
+	return &HashURLIDGenerator{key: []byte(key)}
+}
+
+// hashKeyDerivationLabel метка, с которой ключ хеширования выводится из секрета
+const hashKeyDerivationLabel = "shortener url id hash key"
+
+// DeriveHashKey выводит ключ хеширования ссылок из секрета (HMAC-SHA256 секрета от метки, как шаг expand в HKDF).
+// Так секрет, например ключ подписи cookie, не используется напрямую для другой цели
+func DeriveHashKey(secret string) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(hashKeyDerivationLabel))
+	return string(h.Sum(nil))
+}
+
+// LengthGrowthAttempts implements LengthGrowthPolicy.LengthGrowthAttempts
+// Повторная генерация с той же длиной дает тот же идентификатор, поэтому длина увеличивается со второй попытки
+func (g *HashURLIDGenerator) LengthGrowthAttempts() int {
+	return 1
+}
+
+func (g *HashURLIDGenerator) GenerateURLID(_ context.Context, originalURL string, length int) (string, error) {
+	h := hmac.New(sha256.New, g.key)
+	h.Write([]byte(g.NormalizeURL(originalURL)))
+	encoded := new(big.Int).SetBytes(h.Sum(nil)).Text(62)
+	// big.Int.Text использует цифры и сначала строчные, потом заглавные буквы - это тот же алфавит, что и base62Alphabet
+	if length > len(encoded) {
+		length = len(encoded)
+	}
+	return encoded[:length], nil
+}
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// NormalizeURL implements URLNormalizer.NormalizeURL
+// Схема и хост приводятся к нижнему регистру, порт по умолчанию убирается, пустой путь заменяется на "/".
+// Фрагмент сохраняется, так как ссылка с ним - адрес перенаправления. Если ссылку не удается разобрать, она возвращается без изменений
+func (g *HashURLIDGenerator) NormalizeURL(originalURL string) string {
+	u, err := url.Parse(originalURL)
+	if err != nil {
+		return originalURL
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	if port := u.Port(); port != "" && port != defaultPorts[u.Scheme] {
+		host += ":" + port
+	}
+	u.Host = host
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	return u.String()
+}
@@ -0,0 +1,96 @@
+package shortener
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/config"
+	"testing"
+)
+
+func Test_HashURLIDGenerator(t *testing.T) {
+	tests := []struct {
+		name      string
+		url       string
+		sameAsURL string
+		length    int
+	}{
+		{
+			name:      "should generate same id for same url",
+			url:       "http://google.com/search?q=go",
+			sameAsURL: "http://google.com/search?q=go",
+			length:    10,
+		},
+		{
+			name:      "should normalize scheme, host and default port",
+			url:       "HTTP://Google.COM:80/search?q=go#results",
+			sameAsURL: "http://google.com/search?q=go#results",
+			length:    10,
+		},
+		{
+			name:      "should treat empty path as root",
+			url:       "https://google.com",
+			sameAsURL: "https://google.com/",
+			length:    10,
+		},
+		{
+			name:      "should extend truncated id on longer length",
+			url:       "http://google.com",
+			sameAsURL: "http://google.com",
+			length:    12,
+		},
+	}
+
+	gen := NewHashURLIDGenerator("secret")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := gen.GenerateURLID(context.Background(), tt.url, tt.length)
+			require.NoError(t, err)
+			sameID, err := gen.GenerateURLID(context.Background(), tt.sameAsURL, tt.length)
+			require.NoError(t, err)
+			assert.Len(t, id, tt.length)
+			assert.Equal(t, sameID, id)
+
+			shorterID, err := gen.GenerateURLID(context.Background(), tt.url, tt.length-1)
+			require.NoError(t, err)
+			assert.Equal(t, id[:tt.length-1], shorterID)
+		})
+	}
+
+	otherKeyID, err := NewHashURLIDGenerator("other").GenerateURLID(context.Background(), "http://google.com", 10)
+	require.NoError(t, err)
+	id, err := gen.GenerateURLID(context.Background(), "http://google.com", 10)
+	require.NoError(t, err)
+	assert.NotEqual(t, id, otherKeyID)
+}
+
+func Test_NewURLIDGenerator_HashKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.Config
+		wantKey string
+	}{
+		{
+			name:    "should use dedicated hash key",
+			cfg:     config.Config{URLIDGenerator: "hash", URLIDHashKey: "hash-key", AuthSecretKey: "secret"},
+			wantKey: "hash-key",
+		},
+		{
+			name:    "should derive hash key from auth secret key",
+			cfg:     config.Config{URLIDGenerator: "hash", AuthSecretKey: "secret"},
+			wantKey: DeriveHashKey("secret"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gen, err := NewURLIDGenerator(tt.cfg, nil)
+			require.NoError(t, err)
+			require.IsType(t, &HashURLIDGenerator{}, gen)
+			assert.Equal(t, []byte(tt.wantKey), gen.(*HashURLIDGenerator).key)
+			assert.NotEqual(t, []byte(tt.cfg.AuthSecretKey), gen.(*HashURLIDGenerator).key, "auth secret key should not be used as is")
+		})
+	}
+
+	assert.Equal(t, DeriveHashKey("secret"), DeriveHashKey("secret"))
+	assert.NotEqual(t, DeriveHashKey("secret"), DeriveHashKey("other"))
+}
@@ -2,23 +2,34 @@
 
 package mocks
 
-import mock "github.com/stretchr/testify/mock"
+import (
+	context "context"
+
+	mock "github.com/stretchr/testify/mock"
+)
 
 // URLIDGenerator is an autogenerated mock type for the URLIDGenerator type
 type URLIDGenerator struct {
 	mock.Mock
 }
 
-// GenerateURLID provides a mock function with given fields: originalURL
-func (_m *URLIDGenerator) GenerateURLID(originalURL string) string {
-	ret := _m.Called(originalURL)
+// GenerateURLID provides a mock function with given fields: ctx, originalURL, length
+func (_m *URLIDGenerator) GenerateURLID(ctx context.Context, originalURL string, length int) (string, error) {
+	ret := _m.Called(ctx, originalURL, length)
 
 	var r0 string
-	if rf, ok := ret.Get(0).(func(string) string); ok {
-		r0 = rf(originalURL)
+	if rf, ok := ret.Get(0).(func(context.Context, string, int) string); ok {
+		r0 = rf(ctx, originalURL, length)
 	} else {
 		r0 = ret.Get(0).(string)
 	}
 
-	return r0
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, int) error); ok {
+		r1 = rf(ctx, originalURL, length)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
 }
@@ -0,0 +1,51 @@
+package shortener
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+const (
+	// permutationHalfBits размер половины блока сети Фейстеля. Перестановка определена на числах до 2^48
+	permutationHalfBits = 24
+	permutationHalfMask = 1<<permutationHalfBits - 1
+	permutationMaxValue = 1<<(2*permutationHalfBits) - 1
+	permutationRounds   = 4
+)
+
+// feistelPermutation обратимая перестановка чисел из [0, 2^48), зависящая от ключа (сбалансированная сеть Фейстеля).
+// Позволяет выдавать по последовательным значениям счетчика непоследовательные на вид идентификаторы без коллизий
+type feistelPermutation struct {
+	key []byte
+}
+
+func newFeistelPermutation(key string) *feistelPermutation {
+	return &feistelPermutation{key: []byte(key)}
+}
+
+func (p *feistelPermutation) permute(v uint64) uint64 {
+	left, right := v>>permutationHalfBits&permutationHalfMask, v&permutationHalfMask
+	for round := 0; round < permutationRounds; round++ {
+		left, right = right, left^p.roundFunc(round, right)
+	}
+	return left<<permutationHalfBits | right
+}
+
+// unpermute обратная к permute перестановка
+func (p *feistelPermutation) unpermute(v uint64) uint64 {
+	left, right := v>>permutationHalfBits&permutationHalfMask, v&permutationHalfMask
+	for round := permutationRounds - 1; round >= 0; round-- {
+		left, right = right^p.roundFunc(round, left), left
+	}
+	return left<<permutationHalfBits | right
+}
+
+func (p *feistelPermutation) roundFunc(round int, half uint64) uint64 {
+	var data [9]byte
+	data[0] = byte(round)
+	binary.BigEndian.PutUint64(data[1:], half)
+	h := hmac.New(sha256.New, p.key)
+	h.Write(data[:])
+	return binary.BigEndian.Uint64(h.Sum(nil)) & permutationHalfMask
+}
@@ -0,0 +1,15 @@
+package shortener
+
+import "strings"
+
+// reservedURLIDs первые сегменты путей, занятые роутером, поэтому не доступные в качестве идентификатора ссылки
+var reservedURLIDs = map[string]struct{}{
+	"api":  {},
+	"ping": {},
+}
+
+// IsReservedURLID проверяет, что идентификатор (без учета регистра) совпадает с занятым роутером сегментом пути
+func IsReservedURLID(id string) bool {
+	_, ok := reservedURLIDs[strings.ToLower(id)]
+	return ok
+}
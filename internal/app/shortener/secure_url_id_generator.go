@@ -0,0 +1,56 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/random"
+	"strings"
+)
+
+// DefaultAlphabet латинские буквы и цифры
+const DefaultAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// NoLookAlikesAlphabet латинские буквы и цифры без похожих друг на друга символов (0/O/o, 1/l/I)
+const NoLookAlikesAlphabet = "abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// urlSafeChars символы, которые можно использовать в пути url без экранирования. Точки нет: идентификаторы "." и ".."
+// нормализуются роутерами и клиентами как сегменты пути, и такие ссылки невозможно открыть
+const urlSafeChars = DefaultAlphabet + "-_~"
+
+type SecureRandomURLIDGenerator struct {
+	alphabet string
+}
+
+// NewSecureRandomURLIDGenerator создает генератор идентификаторов на основе crypto/rand.
+// Идентификаторы состоят из символов alphabet, пустой alphabet означает DefaultAlphabet
+func NewSecureRandomURLIDGenerator(alphabet string) (*SecureRandomURLIDGenerator, error) {
+	if alphabet == "" {
+		alphabet = DefaultAlphabet
+	}
+	if err := validateAlphabet(alphabet); err != nil {
+		return nil, err
+	}
+	return &SecureRandomURLIDGenerator{alphabet: alphabet}, nil
+}
+
+func (g *SecureRandomURLIDGenerator) GenerateURLID(_ context.Context, originalURL string, length int) (string, error) {
+	return random.SecureString(length, g.alphabet)
+}
+
+func validateAlphabet(alphabet string) error {
+	seen := make(map[rune]struct{}, len(alphabet))
+	for _, c := range alphabet {
+		if !strings.ContainsRune(urlSafeChars, c) {
+			return fmt.Errorf("alphabet contains character not allowed in url id: %q", c)
+		}
+		if _, ok := seen[c]; ok {
+			return fmt.Errorf("alphabet contains duplicate character: %q", c)
+		}
+		seen[c] = struct{}{}
+	}
+	if len(seen) < 2 {
+		return errors.New("alphabet must contain at least 2 characters")
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package shortener
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func Test_SecureRandomURLIDGenerator(t *testing.T) {
+	tests := []struct {
+		name     string
+		alphabet string
+		wantErr  bool
+	}{
+		{
+			name:     "should use default alphabet when empty",
+			alphabet: "",
+		},
+		{
+			name:     "should use no look-alikes alphabet",
+			alphabet: NoLookAlikesAlphabet,
+		},
+		{
+			name:     "should fail on alphabet with url unsafe characters",
+			alphabet: "abc/",
+			wantErr:  true,
+		},
+		{
+			name:     "should fail on alphabet with dot",
+			alphabet: "ab.",
+			wantErr:  true,
+		},
+		{
+			name:     "should fail on alphabet with duplicates",
+			alphabet: "abca",
+			wantErr:  true,
+		},
+		{
+			name:     "should fail on single character alphabet",
+			alphabet: "a",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gen, err := NewSecureRandomURLIDGenerator(tt.alphabet)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			alphabet := tt.alphabet
+			if alphabet == "" {
+				alphabet = DefaultAlphabet
+			}
+			id, err := gen.GenerateURLID(context.Background(), "http://google.com", 16)
+			require.NoError(t, err)
+			assert.Len(t, id, 16)
+			for _, c := range id {
+				assert.True(t, strings.ContainsRune(alphabet, c), "unexpected character %q", c)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package shortener
+
+import (
+	"context"
+	"fmt"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/repository"
+)
+
+// SequentialURLIDGenerator генерирует идентификаторы, кодируя в base62 значения монотонно возрастающего счетчика.
+// Длина идентификатора определяется значением счетчика, запрошенная длина игнорируется (и не увеличивается при коллизиях, см. LengthGrowthAttempts).
+// Значения, которые кодируются в зарезервированные идентификаторы, пропускаются
+type SequentialURLIDGenerator struct {
+	sequence    repository.SequenceRepository
+	permutation *feistelPermutation
+}
+
+// NewSequentialURLIDGenerator создает генератор последовательных идентификаторов.
+// Если obfuscationKey не пустой, значения счетчика перед кодированием переставляются в зависимости от ключа,
+// чтобы идентификаторы не выглядели последовательными
+func NewSequentialURLIDGenerator(sequence repository.SequenceRepository, obfuscationKey string) *SequentialURLIDGenerator {
+	g := &SequentialURLIDGenerator{sequence: sequence}
+	if obfuscationKey != "" {
+		g.permutation = newFeistelPermutation(obfuscationKey)
+	}
+	return g
+}
+
+// LengthGrowthAttempts implements LengthGrowthPolicy.LengthGrowthAttempts
+// Запрошенная длина не используется, поэтому увеличивать ее нет смысла
+func (g *SequentialURLIDGenerator) LengthGrowthAttempts() int {
+	return 0
+}
+
+func (g *SequentialURLIDGenerator) GenerateURLID(ctx context.Context, _ string, _ int) (string, error) {
+	for {
+		id, err := g.next(ctx)
+		if err != nil || !IsReservedURLID(id) {
+			return id, err
+		}
+	}
+}
+
+func (g *SequentialURLIDGenerator) next(ctx context.Context) (string, error) {
+	v, err := g.sequence.NextSequenceValue(ctx)
+	if err != nil {
+		return "", err
+	}
+	if g.permutation != nil {
+		if v > permutationMaxValue {
+			return "", fmt.Errorf("sequence value %d exceeds obfuscation range", v)
+		}
+		v = g.permutation.permute(v)
+	}
+	return encodeBase62(v), nil
+}
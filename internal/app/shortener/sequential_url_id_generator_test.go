@@ -0,0 +1,98 @@
+package shortener
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type counterSequence struct {
+	value uint64
+}
+
+func (s *counterSequence) NextSequenceValue(_ context.Context) (uint64, error) {
+	s.value++
+	return s.value, nil
+}
+
+func Test_SequentialURLIDGenerator(t *testing.T) {
+	tests := []struct {
+		name           string
+		obfuscationKey string
+		want           []string
+	}{
+		{
+			name: "should encode counter in base62",
+			want: []string{"1", "2", "3"},
+		},
+		{
+			name:           "should generate unique obfuscated ids",
+			obfuscationKey: "secret",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gen := NewSequentialURLIDGenerator(&counterSequence{}, tt.obfuscationKey)
+			ids := make(map[string]struct{})
+			for i := 0; i < 1000; i++ {
+				id, err := gen.GenerateURLID(context.Background(), "http://google.com", 10)
+				require.NoError(t, err)
+				if i < len(tt.want) {
+					assert.Equal(t, tt.want[i], id)
+				}
+				assert.NotContains(t, ids, id)
+				ids[id] = struct{}{}
+			}
+		})
+	}
+}
+
+func Test_SequentialURLIDGenerator_ReservedIDs(t *testing.T) {
+	tests := []struct {
+		name     string
+		seed     uint64
+		reserved string
+		want     []string
+	}{
+		{
+			name:     "should skip api",
+			seed:     40006,
+			reserved: "api",
+			want:     []string{encodeBase62(40007), encodeBase62(40009)},
+		},
+		{
+			name:     "should skip ping",
+			seed:     6028832,
+			reserved: "ping",
+			want:     []string{encodeBase62(6028833), encodeBase62(6028835)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gen := NewSequentialURLIDGenerator(&counterSequence{value: tt.seed}, "")
+			ids := make([]string, 0, len(tt.want))
+			for range tt.want {
+				id, err := gen.GenerateURLID(context.Background(), "http://google.com", 10)
+				require.NoError(t, err)
+				ids = append(ids, id)
+			}
+			assert.Equal(t, tt.want, ids)
+			assert.NotContains(t, ids, tt.reserved)
+		})
+	}
+	assert.Equal(t, "api", encodeBase62(40008))
+	assert.Equal(t, "ping", encodeBase62(6028834))
+}
+
+func Test_feistelPermutation(t *testing.T) {
+	p := newFeistelPermutation("secret")
+	for _, v := range []uint64{0, 1, 2, 62, 1 << 24, permutationMaxValue} {
+		permuted := p.permute(v)
+		assert.LessOrEqual(t, permuted, uint64(permutationMaxValue))
+		assert.Equal(t, v, p.unpermute(permuted))
+	}
+	assert.Equal(t, "0", encodeBase62(0))
+	assert.Equal(t, "10", encodeBase62(62))
+}
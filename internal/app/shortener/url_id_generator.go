@@ -1,20 +1,53 @@
 package shortener
 
-import "github.com/thorgnir-go-study/go-musthave-shortener/internal/app/random"
+import (
+	"context"
+	"github.com/thorgnir-go-study/go-musthave-shortener/internal/app/random"
+)
 
 type URLIDGenerator interface {
-	// GenerateURLID генерирует идентификатор сокращенной ссылки
-	GenerateURLID(originalURL string) string
+	// GenerateURLID генерирует идентификатор сокращенной ссылки длины length
+	GenerateURLID(ctx context.Context, originalURL string, length int) (string, error)
+}
+
+// URLNormalizer реализуется генераторами, идентификатор которых зависит от канонического вида ссылки.
+// Такие ссылки нужно сохранять в каноническом виде, иначе разные записи одной ссылки получат один идентификатор, но в хранилище будут разными ссылками
+type URLNormalizer interface {
+	// NormalizeURL возвращает канонический вид ссылки
+	NormalizeURL(originalURL string) string
+}
+
+// DefaultLengthGrowthAttempts сколько попыток генерации идентификатора делается с базовой длиной, прежде чем начать ее увеличивать,
+// если генератор не реализует LengthGrowthPolicy
+const DefaultLengthGrowthAttempts = 2
+
+// LengthGrowthPolicy позволяет генератору задать, как при коллизиях увеличивать длину идентификатора
+type LengthGrowthPolicy interface {
+	// LengthGrowthAttempts сколько попыток (включая первую) делается с базовой длиной, прежде чем начать ее увеличивать.
+	// 0 - длина не увеличивается
+	LengthGrowthAttempts() int
+}
+
+// URLIDLength возвращает длину идентификатора для попытки attempt (начиная с 0) генерации генератором g при базовой длине length.
+// Если коллизии продолжаются, длина увеличивается на 1 с каждой следующей попыткой
+func URLIDLength(g URLIDGenerator, length int, attempt int) int {
+	growthAttempts := DefaultLengthGrowthAttempts
+	if policy, ok := g.(LengthGrowthPolicy); ok {
+		growthAttempts = policy.LengthGrowthAttempts()
+	}
+	if growthAttempts == 0 || attempt < growthAttempts {
+		return length
+	}
+	return length + attempt - growthAttempts + 1
 }
 
 type RandomStringURLIDGenerator struct {
-	length int
 }
 
-func NewRandomStringURLIDGenerator(length int) *RandomStringURLIDGenerator {
-	return &RandomStringURLIDGenerator{length: length}
+func NewRandomStringURLIDGenerator() *RandomStringURLIDGenerator {
+	return &RandomStringURLIDGenerator{}
 }
 
-func (g *RandomStringURLIDGenerator) GenerateURLID(originalURL string) string {
-	return random.String(g.length)
+func (g *RandomStringURLIDGenerator) GenerateURLID(_ context.Context, originalURL string, length int) (string, error) {
+	return random.String(length), nil
 }
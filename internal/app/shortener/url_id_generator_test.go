@@ -0,0 +1,37 @@
+package shortener
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_URLIDLength(t *testing.T) {
+	tests := []struct {
+		name      string
+		generator URLIDGenerator
+		want      []int
+	}{
+		{
+			name:      "should retry with base length before growing by default",
+			generator: NewRandomStringURLIDGenerator(),
+			want:      []int{10, 10, 11, 12},
+		},
+		{
+			name:      "should grow length from second attempt for hash generator",
+			generator: NewHashURLIDGenerator("secret"),
+			want:      []int{10, 11, 12, 13},
+		},
+		{
+			name:      "should not grow length for sequential generator",
+			generator: NewSequentialURLIDGenerator(&counterSequence{}, ""),
+			want:      []int{10, 10, 10, 10},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for attempt, want := range tt.want {
+				assert.Equal(t, want, URLIDLength(tt.generator, 10, attempt), "attempt %d", attempt)
+			}
+		})
+	}
+}
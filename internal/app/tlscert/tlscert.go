@@ -0,0 +1,128 @@
+package tlscert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// selfSignedValidity срок действия сгенерированного сертификата
+const selfSignedValidity = 365 * 24 * time.Hour
+
+// LoadOrCreate загружает сертификат и ключ из certFile и keyFile (в формате PEM).
+// Если обоих файлов нет - генерирует самоподписанный сертификат для hosts (имен и IP-адресов) и сохраняет его в эти файлы,
+// чтобы при следующих запусках использовался тот же сертификат. Если есть только один из файлов - возвращает ошибку
+func LoadOrCreate(certFile string, keyFile string, hosts []string) (tls.Certificate, error) {
+	certExists, err := fileExists(certFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	keyExists, err := fileExists(keyFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	switch {
+	case certExists && keyExists:
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return tls.Certificate{}, fmt.Errorf("could not load tls certificate: %w", err)
+		}
+		return cert, nil
+	case certExists:
+		return tls.Certificate{}, fmt.Errorf("tls certificate %s found, but key %s does not exist", certFile, keyFile)
+	case keyExists:
+		return tls.Certificate{}, fmt.Errorf("tls key %s found, but certificate %s does not exist", keyFile, certFile)
+	}
+
+	certPEM, keyPEM, err := generateSelfSigned(hosts, time.Now())
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("could not generate self-signed certificate: %w", err)
+	}
+	if err = writeFile(keyFile, keyPEM, 0600); err != nil {
+		return tls.Certificate{}, err
+	}
+	if err = writeFile(certFile, certPEM, 0644); err != nil {
+		return tls.Certificate{}, err
+	}
+	log.Warn().Str("cert", certFile).Str("key", keyFile).Strs("hosts", hosts).Msg("tls certificate not found, self-signed certificate generated")
+
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// generateSelfSigned возвращает самоподписанный сертификат и его ключ (ECDSA P-256) в формате PEM
+func generateSelfSigned(hosts []string, now time.Time) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{Organization: []string{"URL Shortener"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if host != "" {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	if len(template.DNSNames) > 0 {
+		template.Subject.CommonName = template.DNSNames[0]
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+func fileExists(filename string) (bool, error) {
+	_, err := os.Stat(filename)
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return false, err
+}
+
+func writeFile(filename string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return fmt.Errorf("could not create directory for %s: %w", filename, err)
+	}
+	if err := os.WriteFile(filename, data, perm); err != nil {
+		return fmt.Errorf("could not write %s: %w", filename, err)
+	}
+	return nil
+}
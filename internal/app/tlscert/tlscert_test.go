@@ -0,0 +1,65 @@
+package tlscert
+
+import (
+	"crypto/x509"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_LoadOrCreate(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls", "cert.pem")
+	keyFile := filepath.Join(dir, "tls", "key.pem")
+
+	generated, err := LoadOrCreate(certFile, keyFile, []string{"localhost", "127.0.0.1", "short.example"})
+	require.NoError(t, err)
+
+	leaf, err := x509.ParseCertificate(generated.Certificate[0])
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"localhost", "short.example"}, leaf.DNSNames)
+	require.Len(t, leaf.IPAddresses, 1)
+	assert.True(t, leaf.IPAddresses[0].Equal(net.ParseIP("127.0.0.1")))
+	assert.NoError(t, leaf.VerifyHostname("short.example"))
+
+	keyInfo, err := os.Stat(keyFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), keyInfo.Mode().Perm())
+
+	loaded, err := LoadOrCreate(certFile, keyFile, []string{"other.example"})
+	require.NoError(t, err)
+	assert.Equal(t, generated.Certificate, loaded.Certificate, "persisted certificate should be reused")
+}
+
+func Test_LoadOrCreate_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+	}{
+		{
+			name:  "should fail when only certificate exists",
+			files: map[string]string{"cert.pem": "cert"},
+		},
+		{
+			name:  "should fail when only key exists",
+			files: map[string]string{"key.pem": "key"},
+		},
+		{
+			name:  "should fail on invalid pem",
+			files: map[string]string{"cert.pem": "cert", "key.pem": "key"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0600))
+			}
+			_, err := LoadOrCreate(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), []string{"localhost"})
+			assert.Error(t, err)
+		})
+	}
+}